@@ -6,29 +6,89 @@
 package config
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"path/filepath"
+	"io/fs"
+	"log/slog"
 	"strings"
+	"sync"
 
-	"github.com/kelseyhightower/envconfig"
 	yaml "gopkg.in/yaml.v3"
 )
 
 // Config holds the common information for options: name and
 // directories from where to load values.
 type Config struct {
-	Name    string
-	Dirs    []string
-	options []options
+	Name string
+	Dirs []string
+	// FS holds file systems, like embedded or zip archive files, with
+	// configuration files in their root directories. Use fs.Sub for files
+	// in subdirectories. Files from FS are loaded before files from Dirs, so
+	// that values in Dirs override them.
+	FS []fs.FS
+	// Profile is the name of the environment specific configuration, like
+	// "production". For every options name, for example "http", Load reads
+	// files like http.production.yaml after http.yaml from every directory,
+	// overriding its values. If Profile is empty, the value of environment
+	// variable returned by ProfileEnv method is used.
+	Profile string
+	// Interpolate enables replacing expressions like ${SMTP_HOST:-localhost}
+	// or ${http.listen} in configuration files with values of environment
+	// variables and other options before they are decoded.
+	Interpolate bool
+	// Secrets enables resolving secret references with SecretScheme, like
+	// secret://file/run/secrets/smtp, and decrypting values with
+	// EncryptedPrefix in string values of options after they are loaded
+	// from all sources. If it is false, such values are left as they are.
+	Secrets bool
+	// UnknownKeys defines how keys in configuration files that do not
+	// correspond to any options field are handled. By default, they are
+	// ignored.
+	UnknownKeys Mode
+	// DeprecatedKeys defines how keys and environment variables that are
+	// declared as renamed with Alias or the alias struct tag, and fields
+	// with the deprecated struct tag, are handled when they are set. Their
+	// values are loaded in every mode. By default, they are not reported.
+	DeprecatedKeys Mode
+	// Key is the AES key that decrypts values in configuration files with
+	// EncryptedPrefix, created with Encrypt function, if Secrets is true.
+	// If it is nil, the key is read from the environment variable returned
+	// by KeyEnv method.
+	Key []byte
+	// Layers defines sources of configuration values in order of their
+	// precedence, from the lowest to the highest, for example:
+	//
+	//	[]Layer{FileSystem(embedded), Dir("/etc/myapp"), Except(Env, "secrets"), Flags}
+	//
+	// If Layers is nil, file systems in FS and directories in Dirs are
+	// followed by Env and Flags layers.
+	Layers []Layer
+	// Logger is used to report problems that can not be returned as
+	// errors, like failed reloads. If it is nil, slog.Default() is used.
+	Logger *slog.Logger
+
+	mu         sync.Mutex
+	options    []options
+	formatList []format
+	listeners  map[string][]func(old, new Options)
+	origins    map[string]map[string]Origin
+	flags      map[string][]*flagValue
+	aliases    map[string][]alias
+	migrations map[string]map[int]Migration
+
+	secretProviders map[string]SecretProvider
+	// included are files that are included by configuration files of
+	// options in the last load, so that they are watched
+	included map[string][]file
+
+	// reloadMu serializes reloads together with notifications of changes
+	reloadMu sync.Mutex
 }
 
 type options struct {
-	name string
-	o    Options
+	name     string
+	o        Options
+	defaults Options
 }
 
 // New creates a new instance of Config.
@@ -39,46 +99,216 @@ func New(name string, dirs ...string) (c *Config) {
 	}
 }
 
-// Register adds new Options to the Config.
+// Register adds new Options to the Config. Values of the Options at the
+// time of registration are used as defaults when the configuration is
+// reloaded.
 func (c *Config) Register(name string, o Options) {
-	c.options = append(c.options, options{name: name, o: o})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.options = append(c.options, options{name: name, o: o, defaults: clone(o)})
 }
 
-// Load reads configuration values from json and yaml files
-// in config directories, and also from environment variables.
+// Load reads configuration values from yaml, json, toml and dotenv files,
+// and files of formats added with RegisterFormat, in config file systems
+// and directories, and also from environment variables and flags bound
+// with BindFlags, or from Layers if they are set.
 func (c *Config) Load() (err error) {
-	for _, o := range c.options {
-		for _, dir := range c.Dirs {
-			f := filepath.Join(dir, o.name+".yaml")
-			if _, err := os.Stat(f); !os.IsNotExist(err) {
-				if err := loadYAML(f, o.o); err != nil {
-					return fmt.Errorf("load yaml %q config: %w", o.name, err)
-				}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	values := make([]Options, len(c.options))
+	for i, o := range c.options {
+		values[i] = o.o
+	}
+	origins, err := c.load(values)
+	if err != nil {
+		return err
+	}
+	for i, o := range c.options {
+		c.setOrigins(o.name, origins[i])
+	}
+	return
+}
+
+// load reads configuration values into values of registered options,
+// provided in the same order as options, and returns origins of keys that
+// were set.
+func (c *Config) load(values []Options) (origins []map[string]Origin, err error) {
+	docs := make([][]*document, len(c.options))
+	for i, o := range c.options {
+		docs[i], err = c.documents(o.name, values[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.Interpolate {
+		if err := c.interpolate(values, docs); err != nil {
+			return nil, err
+		}
+	}
+	origins = make([]map[string]Origin, len(c.options))
+	for i, o := range c.options {
+		origins[i], err = c.apply(o.name, values[i], docs[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	return origins, nil
+}
+
+// documents reads and parses all existing configuration files of the named
+// options and files that they include.
+func (c *Config) documents(name string, o Options) (docs []*document, err error) {
+	if c.included == nil {
+		c.included = make(map[string][]file)
+	}
+	c.included[name] = nil
+	for i, l := range c.layers() {
+		for _, f := range l.files(c, name) {
+			if _, err := f.src.stat(f.name); errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			fileDocs, err := c.loadDocuments(f.src, name, f.name, f.format, o, nil)
+			if err != nil {
+				return nil, fmt.Errorf("load %s %q config: %w", strings.TrimPrefix(f.format.ext, "."), name, err)
+			}
+			for _, d := range fileDocs {
+				d.layer = i
+			}
+			docs = append(docs, fileDocs...)
+		}
+	}
+	return docs, nil
+}
+
+// apply sets values from documents and other sources of all layers to o,
+// combining slices and maps according to their merge strategies, resolves
+// secret references and returns origins of keys that were set.
+func (c *Config) apply(name string, o Options, docs []*document) (origins map[string]Origin, err error) {
+	fields := optionsFields(o, c.envPrefix(name))
+	ms, err := mergers(fields)
+	if err != nil {
+		return nil, fmt.Errorf("load %q config: %w", name, err)
+	}
+	c.resetAppended(name, o, ms)
+	aliases := c.optionsAliases(name, fields)
+	var deprecated []deprecation
+	for _, d := range docs {
+		ds, err := renameKeys(d, fields, aliases)
+		if err != nil {
+			return nil, fmt.Errorf("load %q config: %w", name, err)
+		}
+		deprecated = append(deprecated, ds...)
+	}
+	if err := c.deprecations(name, deprecated); err != nil {
+		return nil, err
+	}
+	origins = make(map[string]Origin)
+	var unknown FileErrors
+	for i, l := range c.layers() {
+		for _, d := range docs {
+			if d.layer != i {
+				continue
 			}
-			f = filepath.Join(dir, o.name+".json")
-			if _, err := os.Stat(f); !os.IsNotExist(err) {
-				if err := loadJSON(f, o.o); err != nil {
-					return fmt.Errorf("load json %q config: %w", o.name, err)
+			if err := merge(o, ms, origins, func() error {
+				if err := d.decode(o); err != nil {
+					return fmt.Errorf("load %s %q config: %w", d.kind, name, err)
 				}
+				recordFileOrigins(origins, fields, d.filename, d.node, d.json)
+				return nil
+			}); err != nil {
+				return nil, err
 			}
+			unknown = append(unknown, c.unknownKeys(fields, d.filename, d.node, d.json)...)
 		}
-		prefix := strings.Replace(c.Name, "-", "_", -1)
-		if !strings.EqualFold(c.Name, o.name) {
-			prefix += "_" + o.name
+		if err := merge(o, ms, origins, func() error {
+			return l.apply(c, name, o, fields, origins)
+		}); err != nil {
+			return nil, err
 		}
-		if err := envconfig.Process(prefix, o.o); err != nil {
-			return fmt.Errorf("load %q env variables: %v", o.name, err)
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("load %q config: %w", name, unknown)
+	}
+	if c.Secrets {
+		if err := c.resolveSecrets(name, o, fields, origins); err != nil {
+			return nil, err
 		}
 	}
-	return
+	if err := c.deprecations(name, deprecatedFields(fields, origins)); err != nil {
+		return nil, err
+	}
+	return origins, nil
+}
+
+// unknownKeys checks if the configuration file node contains keys that do
+// not correspond to options fields and handles them according to the
+// UnknownKeys mode. Only errors that should fail loading are returned.
+func (c *Config) unknownKeys(fields []*field, filename string, n *yaml.Node, json bool) (errs FileErrors) {
+	if c.UnknownKeys == Ignore {
+		return nil
+	}
+	walkMapping(n, fields, json, func(f *field, key, _ *yaml.Node) {
+		if f != nil {
+			return
+		}
+		if c.UnknownKeys == Warn {
+			c.logger().Warn("unknown config key", "key", key.Value, "file", filename, "line", key.Line, "column", key.Column)
+			return
+		}
+		errs = append(errs, &FileError{
+			File:   filename,
+			Line:   key.Line,
+			Column: key.Column,
+			Err:    fmt.Errorf("%w %q", ErrUnknownKey, key.Value),
+		})
+	})
+	return errs
+}
+
+func (c *Config) setOrigins(name string, origins map[string]Origin) {
+	if c.origins == nil {
+		c.origins = make(map[string]map[string]Origin)
+	}
+	c.origins[name] = origins
+}
+
+func (c *Config) logger() *slog.Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	return slog.Default()
 }
 
 // String returns the YAML-encoded multi document representation
-// of current configuration state.
+// of current configuration state. Sensitive values are redacted.
 func (c *Config) String() string {
+	return c.string(false)
+}
+
+// AnnotatedString returns the same representation of configuration state
+// as String, with every value commented with its origin, the file, the
+// environment variable or the default value that it was set by.
+func (c *Config) AnnotatedString() string {
+	return c.string(true)
+}
+
+func (c *Config) string(annotated bool) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	buf := []byte{}
 	for _, o := range c.options {
-		data, err := yaml.Marshal(o.o)
+		fields := optionsFields(o.o, c.envPrefix(o.name))
+		n, err := redactedNode(o.o, fields)
+		if err != nil {
+			continue
+		}
+		if annotated {
+			annotate(n, fields, c.origins[o.name])
+		}
+		data, err := yaml.Marshal(n)
 		if err != nil {
 			continue
 		}
@@ -103,47 +333,67 @@ type Options interface {
 }
 
 // VerifyAndPrepare executes the same named method on options
-// in config.
+// in config, after validating them against validate struct tags with
+// Validate function. Errors from all options are collected and returned
+// joined, each as OptionsError. Origins of values are set to FieldErrors.
 func (c *Config) VerifyAndPrepare() error {
-	for _, o := range c.options {
-		err := o.o.VerifyAndPrepare()
-		if err != nil {
-			return fmt.Errorf("%s: %w", o.name, err)
-		}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	values := make([]Options, len(c.options))
+	origins := make([]map[string]Origin, len(c.options))
+	for i, o := range c.options {
+		values[i] = o.o
+		origins[i] = c.origins[o.name]
 	}
-	return nil
+	return c.verify(values, origins)
 }
 
-func loadJSON(filename string, o interface{}) error {
-	data, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return fmt.Errorf("read %s: %w", filename, err)
-	}
-	if err = json.Unmarshal(data, o); err != nil {
-		getLineColFromOffset := func(data []byte, offset int64) (line, col int) {
-			start := bytes.LastIndex(data[:offset], []byte{10}) + 1
-			return bytes.Count(data[:start], []byte{10}) + 1, int(offset) - start
+// verify validates and calls VerifyAndPrepare on values of registered
+// options, provided in the same order as options, together with origins
+// of their values.
+func (c *Config) verify(values []Options, origins []map[string]Origin) error {
+	var errs []error
+	for i, o := range c.options {
+		err := Validate(values[i])
+		if err == nil {
+			err = values[i].VerifyAndPrepare()
 		}
-		switch e := err.(type) {
-		case *json.SyntaxError:
-			line, col := getLineColFromOffset(data, e.Offset)
-			return fmt.Errorf("%s:%d:%d: %w", filename, line, col, err)
-		case *json.UnmarshalTypeError:
-			line, col := getLineColFromOffset(data, e.Offset)
-			return fmt.Errorf("%s:%d:%d: expected json %s value but got %s", filename, line, col, e.Type, e.Value)
+		if err == nil {
+			continue
 		}
-		return fmt.Errorf("parse %s: %w", filename, err)
+		var fieldErrs FieldErrors
+		if errors.As(err, &fieldErrs) {
+			for _, fe := range fieldErrs {
+				if fe.Origin.IsDefault() {
+					key, _, _ := strings.Cut(fe.Key, "[")
+					fe.Origin = origins[i][key]
+				}
+			}
+		}
+		errs = append(errs, &OptionsError{Name: o.name, Err: err})
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
-func loadYAML(filename string, o interface{}) error {
-	data, err := ioutil.ReadFile(filename)
+// loadFile reads and parses the configuration file from the source. It
+// returns nil document if the file does not contain any values.
+func loadFile(src source, filename string, f Format, o Options) (*document, error) {
+	data, err := src.readFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", filename, err)
+	}
+	n, err := f.Decode(filename, data, o)
 	if err != nil {
-		return fmt.Errorf("read %s: %w", filename, err)
+		return nil, err
 	}
-	if err = yaml.Unmarshal(data, o); err != nil {
-		return fmt.Errorf("parse %s: %w", filename, err)
+	if n == nil {
+		return nil, nil
 	}
-	return nil
+	_, isJSON := f.(jsonFormat)
+	return &document{
+		filename: filename,
+		node:     n,
+		json:     isJSON,
+	}, nil
 }
@@ -0,0 +1,313 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"resenje.org/x/config"
+)
+
+func TestConfig_Origins(t *testing.T) {
+	dir1 := t.TempDir()
+	dir2 := t.TempDir()
+
+	writeFile(t, filepath.Join(dir1, "http.yaml"), "listen: :80\nport: 80\n")
+	writeFile(t, filepath.Join(dir2, "http.json"), "{\n  \"port\": 8080\n}\n")
+	t.Setenv("TEST_HTTP_DOMAINS", "example.com")
+
+	c := config.New("test", dir1, dir2)
+	c.Register("http", &testOptions{})
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]config.Origin{
+		"listen":  {File: filepath.Join(dir1, "http.yaml"), Line: 1, Column: 1},
+		"port":    {File: filepath.Join(dir2, "http.json"), Line: 2, Column: 3},
+		"domains": {Env: "TEST_HTTP_DOMAINS"},
+	}
+	got := c.Origins("http")
+	if len(got) != len(want) {
+		t.Errorf("got %v origins, want %v", len(got), len(want))
+	}
+	for key, w := range want {
+		if g := c.Origin("http", key); g != w {
+			t.Errorf("got origin %q for %q, want %q", g, key, w)
+		}
+		if g := got[key]; g != w {
+			t.Errorf("got origin %q for %q in origins, want %q", g, key, w)
+		}
+	}
+
+	s := c.AnnotatedString()
+	for _, line := range []string{
+		"listen: :80 # " + want["listen"].String(),
+		"port: 8080 # " + want["port"].String(),
+		"# env TEST_HTTP_DOMAINS",
+	} {
+		if !strings.Contains(s, line) {
+			t.Errorf("annotated string %q does not contain %q", s, line)
+		}
+	}
+}
+
+func TestConfig_Origins_default(t *testing.T) {
+	c := config.New("test", t.TempDir())
+	c.Register("http", &testOptions{Port: 80})
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	o := c.Origin("http", "port")
+	if !o.IsDefault() {
+		t.Errorf("got origin %q, want default", o)
+	}
+	if got, want := o.String(), "default"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+type secretOptions struct {
+	Username string            `yaml:"username"`
+	Password string            `yaml:"password" secret:"true"`
+	Keys     []string          `yaml:"keys" secret:"true"`
+	Empty    string            `yaml:"empty" secret:"true"`
+	Headers  map[string]string `yaml:"headers"`
+}
+
+func (o *secretOptions) VerifyAndPrepare() error { return nil }
+
+func (o *secretOptions) Redact() config.Options {
+	r := *o
+	r.Headers = make(map[string]string)
+	for k, v := range o.Headers {
+		if k == "Authorization" {
+			v = config.Redacted
+		}
+		r.Headers[k] = v
+	}
+	return &r
+}
+
+func TestConfig_String_redacted(t *testing.T) {
+	c := config.New("test")
+	c.Register("secret", &secretOptions{
+		Username: "admin",
+		Password: "s3cr3t",
+		Keys:     []string{"key1", "key2"},
+		Headers:  map[string]string{"Authorization": "Bearer t0k3n"},
+	})
+
+	s := c.String()
+	for _, secret := range []string{"s3cr3t", "key1", "key2", "t0k3n"} {
+		if strings.Contains(s, secret) {
+			t.Errorf("string %q contains secret %q", s, secret)
+		}
+	}
+	for _, line := range []string{
+		"username: admin\n",
+		"password: '" + config.Redacted + "'\n",
+		"    - '" + config.Redacted + "'\n",
+		"empty: \"\"\n",
+	} {
+		if !strings.Contains(s, line) {
+			t.Errorf("string %q does not contain %q", s, line)
+		}
+	}
+}
+
+func TestConfig_Load_unknownKeys(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(dir, "http.yaml"), "listen: :80\nlistne: :81\nprot: 80\n")
+	writeFile(t, filepath.Join(dir, "http.json"), "{\"port\": 80,\n \"domian\": []}\n")
+
+	t.Run("fail", func(t *testing.T) {
+		c := config.New("test", dir)
+		c.UnknownKeys = config.Fail
+		c.Register("http", &testOptions{})
+
+		err := c.Load()
+		if !errors.Is(err, config.ErrUnknownKey) {
+			t.Fatalf("got error %v, want %v", err, config.ErrUnknownKey)
+		}
+		var errs config.FileErrors
+		if !errors.As(err, &errs) {
+			t.Fatalf("got error %T, want %T", err, errs)
+		}
+		want := []string{
+			filepath.Join(dir, "http.yaml") + `:2:1: unknown key "listne"`,
+			filepath.Join(dir, "http.yaml") + `:3:1: unknown key "prot"`,
+			filepath.Join(dir, "http.json") + `:2:2: unknown key "domian"`,
+		}
+		if len(errs) != len(want) {
+			t.Fatalf("got %v errors, want %v", len(errs), len(want))
+		}
+		for i, w := range want {
+			if got := errs[i].Error(); got != w {
+				t.Errorf("got error %q, want %q", got, w)
+			}
+		}
+	})
+
+	t.Run("fail in all directories", func(t *testing.T) {
+		local := t.TempDir()
+		writeFile(t, filepath.Join(local, "http.yaml"), "lsiten: :82\n")
+
+		c := config.New("test", dir, local)
+		c.UnknownKeys = config.Fail
+		c.Register("http", &testOptions{})
+
+		var errs config.FileErrors
+		if err := c.Load(); !errors.As(err, &errs) {
+			t.Fatalf("got error %v, want %T", err, errs)
+		}
+		if got, want := len(errs), 4; got != want {
+			t.Fatalf("got %v errors, want %v", got, want)
+		}
+		if got, want := errs[3].Error(), filepath.Join(local, "http.yaml")+`:1:1: unknown key "lsiten"`; got != want {
+			t.Errorf("got error %q, want %q", got, want)
+		}
+	})
+
+	t.Run("warn", func(t *testing.T) {
+		var buf bytes.Buffer
+		c := config.New("test", dir)
+		c.UnknownKeys = config.Warn
+		c.Logger = slog.New(slog.NewTextHandler(&buf, nil))
+		c.Register("http", &testOptions{})
+
+		if err := c.Load(); err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []string{"listne", "prot", "domian"} {
+			if !strings.Contains(buf.String(), "key="+key) {
+				t.Errorf("log %q does not contain key %q", buf.String(), key)
+			}
+		}
+	})
+
+	t.Run("ignore", func(t *testing.T) {
+		c := config.New("test", dir)
+		c.Register("http", &testOptions{})
+
+		if err := c.Load(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestConfig_Load_yamlErrors(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "http.yaml")
+
+	for _, tc := range []struct {
+		name string
+		data string
+		want []string
+	}{
+		{
+			name: "type",
+			data: "listen: :80\nport: eighty\ndomains: example.com\n",
+			want: []string{
+				filename + ":2:7: cannot unmarshal !!str `eighty` into int",
+				filename + ":3:10: cannot unmarshal !!str `example...` into []string",
+			},
+		},
+		{
+			name: "syntax",
+			data: "listen: :80\n  port: 80\n",
+			want: []string{
+				filename + ":2: mapping values are not allowed in this context",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			writeFile(t, filename, tc.data)
+
+			c := config.New("test", dir)
+			c.Register("http", &testOptions{})
+
+			err := c.Load()
+			var errs config.FileErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("got error %v, want %T", err, errs)
+			}
+			if len(errs) != len(tc.want) {
+				t.Fatalf("got errors %q, want %q", errs, tc.want)
+			}
+			for i, w := range tc.want {
+				if got := errs[i].Error(); got != w {
+					t.Errorf("got error %q, want %q", got, w)
+				}
+			}
+		})
+	}
+}
+
+var errInvalidDomain = errors.New("invalid domain")
+
+type verifiedOptions struct {
+	Port    int      `yaml:"port"`
+	Domains []string `yaml:"domains"`
+}
+
+func (o *verifiedOptions) VerifyAndPrepare() error {
+	var errs config.FieldErrors
+	if o.Port <= 0 {
+		errs = append(errs, &config.FieldError{Key: "port", Err: errors.New("must be positive")})
+	}
+	for i, d := range o.Domains {
+		if !strings.Contains(d, ".") {
+			errs = append(errs, &config.FieldError{Key: fmt.Sprintf("domains[%v]", i), Err: errInvalidDomain})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func TestConfig_VerifyAndPrepare(t *testing.T) {
+	c := config.New("test")
+	c.Register("http", &testOptions{Port: -1})
+	c.Register("api", &verifiedOptions{Domains: []string{"example.com", "localhost"}})
+	c.Register("valid", &testOptions{Port: 80})
+
+	err := c.VerifyAndPrepare()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	want := "http: negative port\napi: port: must be positive\napi: domains[1]: invalid domain"
+	if got := err.Error(); got != want {
+		t.Errorf("got error %q, want %q", got, want)
+	}
+	if !errors.Is(err, errInvalidDomain) {
+		t.Errorf("got error %v, want %v", err, errInvalidDomain)
+	}
+	var oe *config.OptionsError
+	if !errors.As(err, &oe) {
+		t.Fatalf("got error %T, want %T", err, oe)
+	}
+	if oe.Name != "http" {
+		t.Errorf("got options name %q, want %q", oe.Name, "http")
+	}
+	var fe *config.FieldError
+	if !errors.As(err, &fe) {
+		t.Fatalf("got error %T, want %T", err, fe)
+	}
+	if fe.Key != "port" {
+		t.Errorf("got field key %q, want %q", fe.Key, "port")
+	}
+}
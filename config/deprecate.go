@@ -0,0 +1,227 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// ErrDeprecatedKey is returned by Load in FieldError for keys that are
+// deprecated if DeprecatedKeys mode is Fail.
+var ErrDeprecatedKey = errors.New("deprecated key")
+
+// alias maps an old key of the options to the key of a field. Keys are dot
+// separated paths of yaml keys.
+type alias struct {
+	old, new string
+}
+
+// Alias declares that the old key, a dot separated path of yaml keys like
+// "notify-addresses" or "mail.password", in configuration files of the
+// named options is renamed to the new key of an options field, like
+// "notify" or "smtp.password". Values under old keys are loaded into new
+// fields, unless new keys are also set, and reported according to the
+// DeprecatedKeys mode. The environment variable of the old key, with dots
+// and dashes in the key replaced by underscores, like
+// MYAPP_EMAIL_NOTIFY_ADDRESSES, is read in the same way.
+//
+// Aliases can also be declared with the alias struct tag on options fields
+// with comma separated old keys at the same level as the field, like
+// alias:"notify-addresses,notify_addresses". A field with the deprecated
+// struct tag, like deprecated:"use tls.cert instead", is reported when any
+// source sets its value.
+func (c *Config) Alias(name, old, new string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.aliases == nil {
+		c.aliases = make(map[string][]alias)
+	}
+	c.aliases[name] = append(c.aliases[name], alias{old: old, new: new})
+}
+
+// optionsAliases returns aliases of the named options that are registered
+// with Alias and declared with struct tags.
+func (c *Config) optionsAliases(name string, fields []*field) []alias {
+	aliases := append([]alias{}, c.aliases[name]...)
+	for _, f := range leafFields(fields) {
+		tag := f.tag.Get("alias")
+		if tag == "" || f.key == "" {
+			continue
+		}
+		parent := strings.TrimSuffix(f.path, f.key)
+		for _, a := range strings.Split(tag, ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				aliases = append(aliases, alias{old: parent + a, new: f.path})
+			}
+		}
+	}
+	return aliases
+}
+
+// deprecation is a deprecated key that is set in configuration.
+type deprecation struct {
+	key    string
+	use    string
+	origin Origin
+}
+
+// deprecations handles deprecated keys of the named options according to
+// the DeprecatedKeys mode. Only an error that should fail loading is
+// returned.
+func (c *Config) deprecations(name string, ds []deprecation) error {
+	if len(ds) == 0 {
+		return nil
+	}
+	switch c.DeprecatedKeys {
+	case Warn:
+		for _, d := range ds {
+			c.logger().Warn("deprecated config key", "options", name, "key", d.key, "use", d.use, "origin", d.origin.String())
+		}
+	case Fail:
+		errs := make(FieldErrors, 0, len(ds))
+		for _, d := range ds {
+			errs = append(errs, &FieldError{
+				Key:    d.key,
+				Origin: d.origin,
+				Err:    fmt.Errorf("%w, %s", ErrDeprecatedKey, d.use),
+			})
+		}
+		return fmt.Errorf("load %q config: %w", name, errs)
+	}
+	return nil
+}
+
+// renameKeys moves values under old keys in the document to keys of new
+// fields and returns deprecations for old keys that are found, in order of
+// their positions.
+func renameKeys(d *document, fields []*field, aliases []alias) (ds []deprecation, err error) {
+	root := resolveNode(d.node)
+	if root == nil || root.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	paths := make(map[string][]*field)
+	fieldPaths(fields, nil, paths)
+	for _, a := range aliases {
+		path, ok := paths[a.new]
+		if !ok {
+			return nil, fmt.Errorf("alias %s: unknown key %s", a.old, a.new)
+		}
+		key, value := takeNode(root, strings.Split(a.old, "."))
+		if key == nil {
+			continue
+		}
+		ds = append(ds, deprecation{
+			key:    a.old,
+			use:    "use " + a.new,
+			origin: Origin{File: d.filename, Line: key.Line, Column: key.Column},
+		})
+		if lookupNode(root, fields, a.new, d.json) != nil {
+			// the value under the new key takes precedence
+			continue
+		}
+		setPath(root, path, d.json, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Line: key.Line, Column: key.Column}, value)
+	}
+	sort.SliceStable(ds, func(i, j int) bool {
+		if ds[i].origin.Line != ds[j].origin.Line {
+			return ds[i].origin.Line < ds[j].origin.Line
+		}
+		return ds[i].origin.Column < ds[j].origin.Column
+	})
+	return ds, nil
+}
+
+// takeNode removes the key under the sequence of keys from the mapping
+// node, together with mappings that are left empty, and returns the key and
+// the value nodes, or nil if the key is not found.
+func takeNode(n *yaml.Node, keys []string) (key, value *yaml.Node) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value != keys[0] {
+			continue
+		}
+		if len(keys) == 1 {
+			key, value = n.Content[i], n.Content[i+1]
+			n.Content = append(n.Content[:i:i], n.Content[i+2:]...)
+			return key, value
+		}
+		v := resolveNode(n.Content[i+1])
+		if v == nil || v.Kind != yaml.MappingNode {
+			return nil, nil
+		}
+		key, value = takeNode(v, keys[1:])
+		if key != nil && len(v.Content) == 0 {
+			// remove the mapping that is left empty
+			n.Content = append(n.Content[:i:i], n.Content[i+2:]...)
+		}
+		return key, value
+	}
+	return nil, nil
+}
+
+// applyEnvAliases sets values of new fields from environment variables of
+// old keys if environment variables of new fields are not set.
+func (c *Config) applyEnvAliases(name string, o Options, fields []*field, origins map[string]Origin) error {
+	paths := make(map[string][]*field)
+	fieldPaths(fields, nil, paths)
+	byPath := make(map[string]*field)
+	for _, f := range leafFields(fields) {
+		byPath[f.path] = f
+	}
+
+	var ds []deprecation
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, a := range c.optionsAliases(name, fields) {
+		f, ok := byPath[a.new]
+		if !ok || f.envKey == "" {
+			continue
+		}
+		env := strings.ToUpper(c.envPrefix(name) + "_" + strings.NewReplacer(".", "_", "-", "_").Replace(a.old))
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			continue
+		}
+		ds = append(ds, deprecation{key: a.old, use: "use " + f.envKey, origin: Origin{Env: env}})
+		if o := origins[f.path]; o.Env != "" || o.Flag != "" {
+			// the environment variable of the new key takes precedence
+			continue
+		}
+		setPath(root, paths[f.path], false, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str"}, envValueNode(f, value, 0, 0))
+		origins[f.path] = Origin{Env: env}
+	}
+	if err := c.deprecations(name, ds); err != nil {
+		return err
+	}
+	if len(root.Content) == 0 {
+		return nil
+	}
+	if err := root.Decode(o); err != nil {
+		return fmt.Errorf("load %q env variables: %w", name, err)
+	}
+	return nil
+}
+
+// deprecatedFields returns deprecations for fields with the deprecated
+// struct tag that are set by any source.
+func deprecatedFields(fields []*field, origins map[string]Origin) (ds []deprecation) {
+	for _, f := range leafFields(fields) {
+		use, ok := f.tag.Lookup("deprecated")
+		if !ok {
+			continue
+		}
+		o, ok := origins[f.path]
+		if !ok {
+			continue
+		}
+		ds = append(ds, deprecation{key: f.path, use: use, origin: o})
+	}
+	return ds
+}
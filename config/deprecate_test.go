@@ -0,0 +1,170 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"resenje.org/x/config"
+)
+
+type mailTLS struct {
+	Cert string `yaml:"cert"`
+}
+
+type mailOptions struct {
+	Host     string   `yaml:"host" alias:"server"`
+	Notify   []string `yaml:"notify" alias:"notify-addresses"`
+	Password string   `yaml:"password"`
+	TLS      mailTLS  `yaml:"tls"`
+	CertFile string   `yaml:"cert-file" deprecated:"use tls.cert"`
+}
+
+func (o *mailOptions) VerifyAndPrepare() error { return nil }
+
+func TestConfig_Alias(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "mail.yaml"), "server: smtp.example.com\nnotify-addresses: [ops@example.com]\nsmtp:\n  pass: secret\ncert-file: mail.pem\n")
+	writeFile(t, filepath.Join(dir, "mail.json"), "{\"notify\": [\"dev@example.com\"], \"notify-addresses\": [\"qa@example.com\"]}\n")
+
+	want := &mailOptions{
+		Host:     "smtp.example.com",
+		Notify:   []string{"dev@example.com"},
+		Password: "secret",
+		CertFile: "mail.pem",
+	}
+
+	t.Run("ignore", func(t *testing.T) {
+		c := config.New("test", dir)
+		c.UnknownKeys = config.Fail
+		c.Alias("mail", "smtp.pass", "password")
+		o := &mailOptions{}
+		c.Register("mail", o)
+
+		if err := c.Load(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(o, want) {
+			t.Errorf("got %+v, want %+v", o, want)
+		}
+		if got, want := c.Origin("mail", "host").String(), filepath.Join(dir, "mail.yaml")+":1:1"; got != want {
+			t.Errorf("got origin %q, want %q", got, want)
+		}
+	})
+
+	t.Run("warn", func(t *testing.T) {
+		var buf bytes.Buffer
+		c := config.New("test", dir)
+		c.DeprecatedKeys = config.Warn
+		c.Logger = slog.New(slog.NewTextHandler(&buf, nil))
+		c.Alias("mail", "smtp.pass", "password")
+		o := &mailOptions{}
+		c.Register("mail", o)
+
+		if err := c.Load(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(o, want) {
+			t.Errorf("got %+v, want %+v", o, want)
+		}
+		for _, key := range []string{"server", "notify-addresses", "smtp.pass", "cert-file"} {
+			if !strings.Contains(buf.String(), "key="+key+" ") {
+				t.Errorf("log %q does not contain key %q", buf.String(), key)
+			}
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		c := config.New("test", dir)
+		c.DeprecatedKeys = config.Fail
+		c.Alias("mail", "smtp.pass", "password")
+		c.Register("mail", &mailOptions{})
+
+		err := c.Load()
+		if !errors.Is(err, config.ErrDeprecatedKey) {
+			t.Fatalf("got error %v, want %v", err, config.ErrDeprecatedKey)
+		}
+		var errs config.FieldErrors
+		if !errors.As(err, &errs) {
+			t.Fatalf("got error %T, want %T", err, errs)
+		}
+		yamlFile, jsonFile := filepath.Join(dir, "mail.yaml"), filepath.Join(dir, "mail.json")
+		want := []string{
+			"server: deprecated key, use host (" + yamlFile + ":1:1)",
+			"notify-addresses: deprecated key, use notify (" + yamlFile + ":2:1)",
+			"smtp.pass: deprecated key, use password (" + yamlFile + ":4:3)",
+			"notify-addresses: deprecated key, use notify (" + jsonFile + ":1:33)",
+		}
+		if len(errs) != len(want) {
+			t.Fatalf("got errors %v, want %v", errs, want)
+		}
+		for i, w := range want {
+			if got := errs[i].Error(); got != w {
+				t.Errorf("got error %q, want %q", got, w)
+			}
+		}
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		c := config.New("test", dir)
+		c.Alias("mail", "smtp.pass", "pass")
+		c.Register("mail", &mailOptions{})
+
+		if err := c.Load(); err == nil || !strings.Contains(err.Error(), "alias smtp.pass: unknown key pass") {
+			t.Errorf("got error %v", err)
+		}
+	})
+}
+
+func TestConfig_Alias_env(t *testing.T) {
+	t.Setenv("TEST_MAIL_SERVER", "smtp.example.com")
+	t.Setenv("TEST_MAIL_NOTIFY_ADDRESSES", "ops@example.com,dev@example.com")
+	t.Setenv("TEST_MAIL_NOTIFY", "qa@example.com")
+
+	c := config.New("test")
+	c.DeprecatedKeys = config.Fail
+	c.Register("mail", &mailOptions{})
+
+	err := c.Load()
+	var errs config.FieldErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("got error %v, want %T", err, errs)
+	}
+	want := []string{
+		"server: deprecated key, use TEST_MAIL_HOST (env TEST_MAIL_SERVER)",
+		"notify-addresses: deprecated key, use TEST_MAIL_NOTIFY (env TEST_MAIL_NOTIFY_ADDRESSES)",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("got errors %v, want %v", errs, want)
+	}
+	for i, w := range want {
+		if got := errs[i].Error(); got != w {
+			t.Errorf("got error %q, want %q", got, w)
+		}
+	}
+
+	c = config.New("test")
+	o := &mailOptions{}
+	c.Register("mail", o)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if o.Host != "smtp.example.com" {
+		t.Errorf("got host %q", o.Host)
+	}
+	if got, want := o.Notify, []string{"qa@example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got notify %v, want %v", got, want)
+	}
+	if got, want := c.Origin("mail", "host").String(), "env TEST_MAIL_SERVER"; got != want {
+		t.Errorf("got origin %q, want %q", got, want)
+	}
+}
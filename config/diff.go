@@ -0,0 +1,257 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Change is a difference in the value of a single options key.
+type Change struct {
+	// Options is the name of options.
+	Options string
+	// Key is the dot separated path of yaml keys.
+	Key string
+	// Old and New are values as they would be written in yaml files, with
+	// sensitive values redacted.
+	Old, New string
+}
+
+func (c Change) String() string {
+	return c.Options + ": " + c.Key + ": " + changeValue(c.Old) + " -> " + changeValue(c.New)
+}
+
+func changeValue(s string) string {
+	if s == "" {
+		return "(empty)"
+	}
+	return s
+}
+
+// Diff is a list of changes between two configurations.
+type Diff []Change
+
+// String returns changes grouped by options, one per line.
+func (d Diff) String() string {
+	var b strings.Builder
+	var name string
+	for _, c := range d {
+		if b.Len() == 0 || c.Options != name {
+			name = c.Options
+			fmt.Fprintf(&b, "# %s\n", name)
+		}
+		fmt.Fprintf(&b, "%s: %s -> %s\n", c.Key, changeValue(c.Old), changeValue(c.New))
+	}
+	return b.String()
+}
+
+// Diff returns changes in values of options that are registered in both c
+// and new configurations under the same names. Sensitive values are
+// compared, but redacted in changes.
+func (c *Config) Diff(new *Config) Diff {
+	c.mu.Lock()
+	old := make(map[string]Options, len(c.options))
+	for _, o := range c.options {
+		old[o.name] = clone(o.o)
+	}
+	c.mu.Unlock()
+
+	new.mu.Lock()
+	defer new.mu.Unlock()
+
+	var d Diff
+	for _, o := range new.options {
+		prev, ok := old[o.name]
+		if !ok {
+			continue
+		}
+		fields := optionsFields(o.o, "")
+		oldValues, newValues := diffValues(prev, fields), diffValues(o.o, fields)
+		for _, f := range leafFields(fields) {
+			ov, nv := oldValues[f.path], newValues[f.path]
+			if f.key == "" || ov.raw == nv.raw {
+				continue
+			}
+			d = append(d, Change{
+				Options: o.name,
+				Key:     f.path,
+				Old:     ov.shown,
+				New:     nv.shown,
+			})
+		}
+	}
+	return d
+}
+
+// DiffLoad returns changes that Reload would apply to current values of
+// options, without changing them.
+func (c *Config) DiffLoad() (Diff, error) {
+	fresh, err := c.LoadDirs(c.Dirs...)
+	if err != nil {
+		return nil, err
+	}
+	return c.Diff(fresh), nil
+}
+
+// LoadDirs returns a new Config with the same settings and options as c,
+// but with configuration files in the directories instead of Dirs. Options
+// are loaded starting from values that they had when they were registered
+// in c and verified as Reload does, so that they can be compared with
+// current values. If Layers are set, their Dir layers are replaced by
+// layers of the directories, unless no directories are given, and an error
+// is returned if Layers have no Dir layers or have them filtered by Only or
+// Except.
+func (c *Config) LoadDirs(dirs ...string) (*Config, error) {
+	c.mu.Lock()
+	layers := c.Layers
+	if layers != nil && len(dirs) > 0 {
+		var err error
+		layers, err = replaceDirs(layers, dirs)
+		if err != nil {
+			c.mu.Unlock()
+			return nil, err
+		}
+	}
+	n := &Config{
+		Name:            c.Name,
+		Dirs:            dirs,
+		FS:              c.FS,
+		Profile:         c.Profile,
+		Interpolate:     c.Interpolate,
+		Secrets:         c.Secrets,
+		UnknownKeys:     c.UnknownKeys,
+		DeprecatedKeys:  c.DeprecatedKeys,
+		Key:             c.Key,
+		Layers:          layers,
+		Logger:          c.Logger,
+		formatList:      c.formatList,
+		flags:           c.flags,
+		aliases:         c.aliases,
+		migrations:      c.migrations,
+		secretProviders: maps.Clone(c.secretProviders),
+	}
+	for _, o := range c.options {
+		n.options = append(n.options, options{name: o.name, o: clone(o.defaults), defaults: o.defaults})
+	}
+	c.mu.Unlock()
+
+	if err := n.Load(); err != nil {
+		return nil, err
+	}
+	if err := n.VerifyAndPrepare(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// replaceDirs returns a copy of layers with the first Dir layer replaced by
+// layers of the directories and other Dir layers removed.
+func replaceDirs(layers []Layer, dirs []string) ([]Layer, error) {
+	replaced := make([]Layer, 0, len(layers)+len(dirs))
+	found := false
+	for _, l := range layers {
+		if f, ok := l.(filterLayer); ok && isDirLayer(f.Layer) {
+			return nil, errors.New("directories of filtered layers can not be replaced")
+		}
+		if !isDirLayer(l) {
+			replaced = append(replaced, l)
+			continue
+		}
+		if !found {
+			for _, dir := range dirs {
+				replaced = append(replaced, Dir(dir))
+			}
+			found = true
+		}
+	}
+	if !found {
+		return nil, errors.New("layers have no directories to replace")
+	}
+	return replaced, nil
+}
+
+func isDirLayer(l Layer) bool {
+	f, ok := l.(fileLayer)
+	return ok && f.src.fsys == nil
+}
+
+// DiffCommand runs a command line interface that prints the difference
+// between two configurations, intended to be called from an application
+// subcommand with its arguments. Flags -from and -to are comma separated
+// lists of directories with configuration files. If -from is not set,
+// current values of options are used. If -to is not set, configuration is
+// loaded from Dirs. Directories replace Dir layers if Layers are set, as in
+// LoadDirs.
+func (c *Config) DiffCommand(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(w)
+	from := fs.String("from", "", "comma separated directories of the current configuration, current values if empty")
+	to := fs.String("to", "", "comma separated directories of the new configuration, configuration directories if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	old := c
+	if *from != "" {
+		var err error
+		old, err = c.LoadDirs(strings.Split(*from, ",")...)
+		if err != nil {
+			return fmt.Errorf("from: %w", err)
+		}
+	}
+	dirs := c.Dirs
+	if *to != "" {
+		dirs = strings.Split(*to, ",")
+	}
+	new, err := c.LoadDirs(dirs...)
+	if err != nil {
+		return fmt.Errorf("to: %w", err)
+	}
+
+	d := old.Diff(new)
+	if len(d) == 0 {
+		_, err = fmt.Fprintln(w, "no changes")
+		return err
+	}
+	_, err = io.WriteString(w, d.String())
+	return err
+}
+
+type diffValue struct {
+	// raw is the value for comparison and shown is the redacted value
+	raw, shown string
+}
+
+// diffValues returns values of all leaf fields of options.
+func diffValues(o Options, fields []*field) map[string]diffValue {
+	var raw yaml.Node
+	if err := raw.Encode(o); err != nil {
+		return nil
+	}
+	shown, err := redactedNode(o, fields)
+	if err != nil {
+		return nil
+	}
+	values := make(map[string]diffValue)
+	for _, f := range leafFields(fields) {
+		var v diffValue
+		if n := lookupNode(&raw, fields, f.path, false); n != nil {
+			v.raw = referenceValue(n)
+		}
+		if n := lookupNode(shown, fields, f.path, false); n != nil {
+			v.shown = referenceValue(n)
+		}
+		values[f.path] = v
+	}
+	return values
+}
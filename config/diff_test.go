@@ -0,0 +1,165 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"resenje.org/x/config"
+)
+
+func TestConfig_Diff(t *testing.T) {
+	staging, production := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(staging, "smtp.yaml"), "host: mail.staging.com\npassword: staging\ntokens: [a]\n")
+	writeFile(t, filepath.Join(production, "smtp.yaml"), "host: mail.com\npassword: production\ntokens: [a]\nheaders: {X-A: a}\n")
+
+	c := config.New("test", staging)
+	c.Register("smtp", &smtpOptions{})
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	n, err := c.LoadDirs(production)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := c.Diff(n)
+	want := config.Diff{
+		{Options: "smtp", Key: "host", Old: "mail.staging.com", New: "mail.com"},
+		{Options: "smtp", Key: "password", Old: config.Redacted, New: config.Redacted},
+		{Options: "smtp", Key: "headers", Old: "", New: "{X-A: a}"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got diff %v, want %v", got, want)
+	}
+	wantString := "# smtp\n" +
+		"host: mail.staging.com -> mail.com\n" +
+		"password: ****** -> ******\n" +
+		"headers: (empty) -> {X-A: a}\n"
+	if s := got.String(); s != wantString {
+		t.Errorf("got diff string\n%s\nwant\n%s", s, wantString)
+	}
+}
+
+func TestConfig_DiffLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "http.yaml"), "listen: :80\n")
+
+	o := &testOptions{}
+	c := config.New("test", dir)
+	c.Register("http", o)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := c.DiffLoad()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d) != 0 {
+		t.Errorf("got diff %v, want none", d)
+	}
+
+	writeFile(t, filepath.Join(dir, "http.yaml"), "listen: :8080\n")
+	d, err = c.DiffLoad()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := config.Diff{{Options: "http", Key: "listen", Old: ":80", New: ":8080"}}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("got diff %v, want %v", d, want)
+	}
+	if o.Listen != ":80" {
+		t.Errorf("got listen %q, want %q", o.Listen, ":80")
+	}
+}
+
+type hostOptions struct {
+	Host string `yaml:"host"`
+}
+
+func (o *hostOptions) VerifyAndPrepare() error {
+	o.Host = strings.ToLower(o.Host)
+	return nil
+}
+
+func TestConfig_DiffLoad_verified(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "mail.yaml"), "host: Mail.COM\n")
+
+	c := config.New("test", dir)
+	c.Register("mail", &hostOptions{})
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VerifyAndPrepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := c.DiffLoad()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d) != 0 {
+		t.Errorf("got diff %v, want none", d)
+	}
+}
+
+func TestConfig_DiffCommand(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(a, "http.yaml"), "listen: :80\nport: 80\n")
+	writeFile(t, filepath.Join(b, "http.yaml"), "listen: :80\nport: 8080\n")
+
+	c := config.New("test")
+	c.Register("http", &testOptions{})
+
+	var out strings.Builder
+	if err := c.DiffCommand([]string{"-from", a, "-to", b}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "# http\nport: 80 -> 8080\n"; got != want {
+		t.Errorf("got output %q, want %q", got, want)
+	}
+
+	out.Reset()
+	if err := c.DiffCommand([]string{"-from", a, "-to", a}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "no changes\n"; got != want {
+		t.Errorf("got output %q, want %q", got, want)
+	}
+}
+
+func TestConfig_DiffCommand_layers(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(a, "http.yaml"), "listen: :80\nport: 80\n")
+	writeFile(t, filepath.Join(b, "http.yaml"), "listen: :80\nport: 8080\n")
+
+	c := config.New("test")
+	c.Layers = []config.Layer{config.Dir(a), config.Env}
+	c.Register("http", &testOptions{})
+
+	var out strings.Builder
+	if err := c.DiffCommand([]string{"-from", a, "-to", b}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "# http\nport: 80 -> 8080\n"; got != want {
+		t.Errorf("got output %q, want %q", got, want)
+	}
+
+	c.Layers = []config.Layer{config.Only(config.Dir(a), "http"), config.Env}
+	if _, err := c.LoadDirs(b); err == nil || !strings.Contains(err.Error(), "directories of filtered layers can not be replaced") {
+		t.Errorf("got error %v", err)
+	}
+
+	c.Layers = []config.Layer{config.Env}
+	if _, err := c.LoadDirs(b); err == nil || !strings.Contains(err.Error(), "layers have no directories to replace") {
+		t.Errorf("got error %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// EncryptedPrefix is the prefix of encrypted configuration values, which
+// are decrypted by Load if Config Secrets is true.
+const EncryptedPrefix = "enc:"
+
+// ErrMissingKey is returned by Load in FieldError for encrypted values if
+// the encryption key is not configured.
+var ErrMissingKey = errors.New("missing encryption key")
+
+// NewKey returns a new random 256 bit AES key encoded with base64, in the
+// form that is expected in the environment variable returned by KeyEnv.
+func NewKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseKey decodes the base64 encoded key.
+func ParseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("decode key: %w", err)
+	}
+	if _, err := aes.NewCipher(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Encrypt encrypts the value with AES-GCM and returns it with the
+// EncryptedPrefix, so that it can be written in configuration files.
+func Encrypt(key []byte, value string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	data := aead.Seal(nonce, nonce, []byte(value), nil)
+	return EncryptedPrefix + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// Decrypt decrypts the value returned by Encrypt.
+func Decrypt(key []byte, value string) (string, error) {
+	s, ok := strings.CutPrefix(value, EncryptedPrefix)
+	if !ok {
+		return "", errors.New("value is not encrypted")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("decode encrypted value: %w", err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < aead.NonceSize() {
+		return "", errors.New("encrypted value is too short")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt value: %w", err)
+	}
+	return string(plain), nil
+}
+
+var encryptedRegexp = regexp.MustCompile(EncryptedPrefix + `[A-Za-z0-9_-]+`)
+
+// Rekey decrypts all encrypted values in the configuration file data with
+// the old key and encrypts them with the new key, leaving the rest of the
+// data intact.
+func Rekey(data, oldKey, newKey []byte) ([]byte, error) {
+	var err error
+	data = encryptedRegexp.ReplaceAllFunc(data, func(v []byte) []byte {
+		if err != nil {
+			return v
+		}
+		var s string
+		s, err = Decrypt(oldKey, string(v))
+		if err != nil {
+			return v
+		}
+		s, err = Encrypt(newKey, s)
+		return []byte(s)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// RekeyFile replaces encrypted values in the file with values encrypted
+// with the new key. The file is replaced by renaming a temporary file in
+// the same directory, so that it is never left partially written.
+func RekeyFile(filename string, oldKey, newKey []byte) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	data, err = Rekey(data, oldKey, newKey)
+	if err != nil {
+		return fmt.Errorf("rekey %s: %w", filename, err)
+	}
+	return replaceFile(filename, data, info.Mode().Perm())
+}
+
+// replaceFile writes data to a temporary file in the directory of the file
+// and renames it to the file.
+func replaceFile(filename string, data []byte, perm os.FileMode) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// KeyEnv returns the name of the environment variable with the base64
+// encoded key that decrypts encrypted values if Key is not set, for example
+// MYAPP_CONFIG_KEY for Config with name "myapp". The key can also be read
+// from the file which name is in the variable with the _FILE suffix.
+func (c *Config) KeyEnv() string {
+	return strings.ToUpper(strings.Replace(c.Name, "-", "_", -1)) + "_CONFIG_KEY"
+}
+
+// key returns Key or the key from the environment variable returned by
+// KeyEnv.
+func (c *Config) key() ([]byte, error) {
+	if c.Key != nil {
+		return c.Key, nil
+	}
+	env := c.KeyEnv()
+	if s, ok := os.LookupEnv(env); ok {
+		key, err := ParseKey(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", env, err)
+		}
+		return key, nil
+	}
+	if filename, ok := os.LookupEnv(env + "_FILE"); ok {
+		s, err := readSecretFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("%s_FILE: %w", env, err)
+		}
+		key, err := ParseKey(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s_FILE: %w", env, err)
+		}
+		return key, nil
+	}
+	return nil, ErrMissingKey
+}
+
+// decrypt returns the decrypted value if s is encrypted, otherwise s.
+func (c *Config) decrypt(s string) (string, error) {
+	if !strings.HasPrefix(s, EncryptedPrefix) {
+		return s, nil
+	}
+	key, err := c.key()
+	if err != nil {
+		return "", err
+	}
+	return Decrypt(key, s)
+}
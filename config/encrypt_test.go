@@ -0,0 +1,129 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"resenje.org/x/config"
+)
+
+func newTestKey(t *testing.T) []byte {
+	t.Helper()
+
+	s, err := config.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := config.ParseKey(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestEncrypt(t *testing.T) {
+	key := newTestKey(t)
+
+	v, err := config.Encrypt(key, "s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(v, config.EncryptedPrefix) {
+		t.Fatalf("got %q without prefix", v)
+	}
+	got, err := config.Decrypt(key, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "s3cr3t" {
+		t.Errorf("got %q, want %q", got, "s3cr3t")
+	}
+
+	if _, err := config.Decrypt(newTestKey(t), v); err == nil {
+		t.Error("decrypted with a different key")
+	}
+}
+
+func TestConfig_encryptedValues(t *testing.T) {
+	key := newTestKey(t)
+	password, err := config.Encrypt(key, "s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "smtp.yaml"), "host: mail.com\npassword: "+password+"\n")
+
+	t.Run("key", func(t *testing.T) {
+		o := &smtpOptions{}
+		c := config.New("test", dir)
+		c.Secrets = true
+		c.Key = key
+		c.Register("smtp", o)
+		if err := c.Load(); err != nil {
+			t.Fatal(err)
+		}
+		if o.Password != "s3cr3t" {
+			t.Errorf("got password %q, want %q", o.Password, "s3cr3t")
+		}
+	})
+
+	t.Run("key file env", func(t *testing.T) {
+		keyFile := filepath.Join(t.TempDir(), "key")
+		s, err := config.NewKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(keyFile, []byte(s+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		newKey, err := config.ParseKey(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rekeyed := filepath.Join(t.TempDir(), "smtp.yaml")
+		data, err := os.ReadFile(filepath.Join(dir, "smtp.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, rekeyed, string(data))
+		if err := config.RekeyFile(rekeyed, key, newKey); err != nil {
+			t.Fatal(err)
+		}
+		entries, err := os.ReadDir(filepath.Dir(rekeyed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Errorf("got %v files in the directory, want 1", len(entries))
+		}
+
+		c := config.New("test", filepath.Dir(rekeyed))
+		c.Secrets = true
+		t.Setenv(c.KeyEnv()+"_FILE", keyFile)
+		o := &smtpOptions{}
+		c.Register("smtp", o)
+		if err := c.Load(); err != nil {
+			t.Fatal(err)
+		}
+		if o.Host != "mail.com" || o.Password != "s3cr3t" {
+			t.Errorf("got %+v", o)
+		}
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		c := config.New("test", dir)
+		c.Secrets = true
+		c.Register("smtp", &smtpOptions{})
+		if err := c.Load(); !errors.Is(err, config.ErrMissingKey) {
+			t.Errorf("got error %v, want %v", err, config.ErrMissingKey)
+		}
+	})
+}
@@ -0,0 +1,188 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// ErrUnknownKey is returned by Load in FileError if a configuration file
+// contains a key that does not correspond to any options field and
+// UnknownKeys is set to Fail.
+var ErrUnknownKey = errors.New("unknown key")
+
+// FileError describes a problem at a position in a configuration file.
+// Line and Column are zero if they are not known.
+type FileError struct {
+	File   string
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *FileError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %v", e.File, e.Err)
+	}
+	if e.Column == 0 {
+		return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s:%d:%d: %v", e.File, e.Line, e.Column, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// FileErrors is a list of problems in configuration files.
+type FileErrors []*FileError
+
+func (e FileErrors) Error() string {
+	s := make([]string, 0, len(e))
+	for _, err := range e {
+		s = append(s, err.Error())
+	}
+	return strings.Join(s, "\n")
+}
+
+func (e FileErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// OptionsError is returned by Config VerifyAndPrepare for every options
+// that failed verification.
+type OptionsError struct {
+	// Name is the name under which options are registered.
+	Name string
+	Err  error
+}
+
+func (e *OptionsError) Error() string {
+	var errs FieldErrors
+	if errors.As(e.Err, &errs) {
+		s := make([]string, 0, len(errs))
+		for _, err := range errs {
+			s = append(s, e.Name+": "+err.Error())
+		}
+		return strings.Join(s, "\n")
+	}
+	return e.Name + ": " + e.Err.Error()
+}
+
+func (e *OptionsError) Unwrap() error {
+	return e.Err
+}
+
+// FieldError describes a problem with the value of a single options field.
+type FieldError struct {
+	// Key is the dot separated path of yaml keys of the field, like
+	// "tls.cert", optionally followed by the index of a slice element, like
+	// "domains[2]".
+	Key string
+	// Origin is where the value was set. Config VerifyAndPrepare sets it if
+	// it is not set by options.
+	Origin Origin
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	if e.Origin.IsDefault() {
+		return e.Key + ": " + e.Err.Error()
+	}
+	return e.Key + ": " + e.Err.Error() + " (" + e.Origin.String() + ")"
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// FieldErrors can be returned by Options VerifyAndPrepare method to report
+// problems with values of multiple fields at once.
+type FieldErrors []*FieldError
+
+func (e FieldErrors) Error() string {
+	s := make([]string, 0, len(e))
+	for _, err := range e {
+		s = append(s, err.Error())
+	}
+	return strings.Join(s, "\n")
+}
+
+func (e FieldErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+var yamlLineRegexp = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// yamlErrors converts errors returned by the yaml package to FileErrors
+// with lines extracted from error messages. Yaml package does not provide
+// columns for syntax errors, so they are left as zero.
+func yamlErrors(filename string, err error) error {
+	var msgs []string
+	var e *yaml.TypeError
+	if errors.As(err, &e) {
+		msgs = e.Errors
+	} else {
+		msgs = []string{err.Error()}
+	}
+	errs := make(FileErrors, 0, len(msgs))
+	for _, msg := range msgs {
+		m := yamlLineRegexp.FindStringSubmatch(msg)
+		if m == nil {
+			return fmt.Errorf("parse %s: %w", filename, err)
+		}
+		line, _ := strconv.Atoi(m[1])
+		errs = append(errs, &FileError{
+			File: filename,
+			Line: line,
+			Err:  errors.New(m[2]),
+		})
+	}
+	return errs
+}
+
+// yamlTypeErrors decodes values from the yaml node into every options
+// field separately in order to collect decoding errors with positions of
+// values that caused them.
+func yamlTypeErrors(filename string, n *yaml.Node, o interface{}) (errs FileErrors) {
+	walkMapping(n, optionsFields(o, ""), false, func(f *field, _, value *yaml.Node) {
+		if f == nil {
+			return
+		}
+		err := value.Decode(reflect.New(f.typ).Interface())
+		var e *yaml.TypeError
+		if !errors.As(err, &e) {
+			return
+		}
+		for _, msg := range e.Errors {
+			if m := yamlLineRegexp.FindStringSubmatch(msg); m != nil {
+				msg = m[2]
+			}
+			errs = append(errs, &FileError{
+				File:   filename,
+				Line:   value.Line,
+				Column: value.Column,
+				Err:    errors.New(msg),
+			})
+		}
+	})
+	return errs
+}
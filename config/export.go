@@ -0,0 +1,257 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// envVar is an environment variable with the value of an options field.
+type envVar struct {
+	name   string
+	value  string
+	secret bool
+}
+
+// ExportEnv returns current values of all options in the dotenv format,
+// with names of environment variables that Load reads, so that it can be
+// used as an environment file of a service or a container. Sensitive
+// values are redacted, unless secrets is true. Fields that are ignored by
+// envconfig, nil pointers and empty slices and maps are not exported.
+func (c *Config) ExportEnv(secrets bool) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var b strings.Builder
+	for i, o := range c.options {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "# %s\n", o.name)
+		for _, v := range c.envVars(o.name, o.o, secrets) {
+			fmt.Fprintf(&b, "%s=%s\n", v.name, dotenvQuote(v.value))
+		}
+	}
+	return b.String()
+}
+
+// ExportJSON returns current values of the named options in the json
+// format. Sensitive values are redacted, unless secrets is true.
+func (c *Config) ExportJSON(name string, secrets bool) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, o := range c.options {
+		if o.name != name {
+			continue
+		}
+		v := o.o
+		if r, ok := v.(Redacter); ok && !secrets {
+			v = r.Redact()
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("export %q json: %w", name, err)
+		}
+		if secrets {
+			return indentJSON(data)
+		}
+		n, err := jsonNode(data)
+		if err != nil {
+			return nil, fmt.Errorf("export %q json: %w", name, err)
+		}
+		walkMapping(n, optionsFields(v, ""), true, func(f *field, _, value *yaml.Node) {
+			if f != nil && isSecret(f) {
+				maskNode(value)
+			}
+		})
+		data, err = nodeJSON(n)
+		if err != nil {
+			return nil, fmt.Errorf("export %q json: %w", name, err)
+		}
+		return indentJSON(data)
+	}
+	return nil, fmt.Errorf("unknown options %q", name)
+}
+
+func indentJSON(data []byte) ([]byte, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// ExportKubernetes returns current values of all options as environment
+// variables in a Kubernetes ConfigMap and a Secret with the name, in a
+// yaml stream with two documents. Values of fields marked with the secret
+// struct tag and values that are changed by Redacter are in the Secret and
+// all other values are in the ConfigMap, so that both can be referenced by
+// envFrom in the container spec.
+func (c *Config) ExportKubernetes(name string) (string, error) {
+	c.mu.Lock()
+	data := make(map[string]string)
+	stringData := make(map[string]string)
+	for _, o := range c.options {
+		redacted := make(map[string]string)
+		for _, v := range c.envVars(o.name, o.o, false) {
+			redacted[v.name] = v.value
+		}
+		for _, v := range c.envVars(o.name, o.o, true) {
+			if r, ok := redacted[v.name]; v.secret || !ok || r != v.value {
+				stringData[v.name] = v.value
+			} else {
+				data[v.name] = v.value
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	type metadata struct {
+		Name string `yaml:"name"`
+	}
+	configMap := struct {
+		APIVersion string            `yaml:"apiVersion"`
+		Kind       string            `yaml:"kind"`
+		Metadata   metadata          `yaml:"metadata"`
+		Data       map[string]string `yaml:"data,omitempty"`
+	}{"v1", "ConfigMap", metadata{name}, data}
+	secret := struct {
+		APIVersion string            `yaml:"apiVersion"`
+		Kind       string            `yaml:"kind"`
+		Metadata   metadata          `yaml:"metadata"`
+		Type       string            `yaml:"type"`
+		StringData map[string]string `yaml:"stringData,omitempty"`
+	}{"v1", "Secret", metadata{name}, "Opaque", stringData}
+
+	var b strings.Builder
+	for i, doc := range []interface{}{configMap, secret} {
+		if i > 0 {
+			b.WriteString("---\n")
+		}
+		out, err := yaml.Marshal(doc)
+		if err != nil {
+			return "", fmt.Errorf("export kubernetes manifests: %w", err)
+		}
+		b.Write(out)
+	}
+	return b.String(), nil
+}
+
+// envVars returns environment variables with values of options fields in
+// the order of fields.
+func (c *Config) envVars(name string, o Options, secrets bool) (vars []envVar) {
+	if r, ok := o.(Redacter); ok && !secrets {
+		o = r.Redact()
+	}
+	root := reflect.Indirect(reflect.ValueOf(o))
+	if root.Kind() != reflect.Struct {
+		return nil
+	}
+	for _, f := range leafFields(optionsFields(o, c.envPrefix(name))) {
+		if f.envKey == "" {
+			continue
+		}
+		v, err := root.FieldByIndexErr(f.index)
+		if err != nil {
+			// nil pointer to a parent struct
+			continue
+		}
+		s, ok := envString(v)
+		if !ok {
+			continue
+		}
+		if isSecret(f) && !secrets && s != "" {
+			s = Redacted
+		}
+		vars = append(vars, envVar{name: f.envKey, value: s, secret: isSecret(f)})
+	}
+	return vars
+}
+
+// envString returns the value as envconfig parses it from environment
+// variables. It returns false for nil pointers and empty slices and maps.
+func envString(v reflect.Value) (string, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", false
+		}
+		if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+			return textString(m)
+		}
+		v = v.Elem()
+	}
+	if v.CanAddr() {
+		if m, ok := v.Addr().Interface().(encoding.TextMarshaler); ok {
+			return textString(m)
+		}
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		return textString(m)
+	}
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String(), true
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), true
+		}
+		if v.Len() == 0 {
+			return "", false
+		}
+		s := make([]string, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			e, _ := envString(v.Index(i))
+			s = append(s, e)
+		}
+		return strings.Join(s, ","), true
+	case reflect.Map:
+		if v.Len() == 0 {
+			return "", false
+		}
+		s := make([]string, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			k, _ := envString(iter.Key())
+			e, _ := envString(iter.Value())
+			s = append(s, k+":"+e)
+		}
+		sort.Strings(s)
+		return strings.Join(s, ","), true
+	}
+	return fmt.Sprint(v.Interface()), true
+}
+
+func textString(m encoding.TextMarshaler) (string, bool) {
+	text, err := m.MarshalText()
+	if err != nil {
+		return "", false
+	}
+	return string(text), true
+}
+
+// dotenvQuote returns the value in double quotes if it can not be written
+// without them in a dotenv file.
+func dotenvQuote(s string) string {
+	if s == "" || !strings.ContainsAny(s, " \t\r\n#'\"\\") {
+		return s
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
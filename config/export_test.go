@@ -0,0 +1,236 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"resenje.org/x/config"
+)
+
+type exportOptions struct {
+	Host     string            `yaml:"host" json:"host"`
+	Password string            `yaml:"password" json:"password" split_words:"true" secret:"true"`
+	Timeout  time.Duration     `yaml:"timeout" json:"timeout"`
+	Tokens   []string          `yaml:"tokens" json:"tokens"`
+	Headers  map[string]string `yaml:"headers" json:"headers"`
+	Note     string            `yaml:"note" json:"note"`
+	Internal string            `yaml:"internal" json:"-" ignored:"true"`
+	TLS      *struct {
+		Cert string `yaml:"cert" json:"cert"`
+	} `yaml:"tls" json:"tls"`
+}
+
+func (o *exportOptions) VerifyAndPrepare() error { return nil }
+
+func newExportConfig() *config.Config {
+	c := config.New("test")
+	c.Register("smtp", &exportOptions{
+		Host:     "mail.com",
+		Password: "s3cr3t",
+		Timeout:  time.Minute,
+		Tokens:   []string{"a", "b"},
+		Headers:  map[string]string{"X-B": "b", "X-A": "a"},
+		Note:     `say "hi" # now`,
+		Internal: "internal",
+	})
+	c.Register("http", &testOptions{Listen: ":80"})
+	return c
+}
+
+func TestConfig_ExportEnv(t *testing.T) {
+	c := newExportConfig()
+
+	want := "# smtp\n" +
+		"TEST_SMTP_HOST=mail.com\n" +
+		"TEST_SMTP_PASSWORD=******\n" +
+		"TEST_SMTP_TIMEOUT=1m0s\n" +
+		"TEST_SMTP_TOKENS=a,b\n" +
+		"TEST_SMTP_HEADERS=X-A:a,X-B:b\n" +
+		"TEST_SMTP_NOTE=\"say \\\"hi\\\" # now\"\n" +
+		"\n" +
+		"# http\n" +
+		"TEST_HTTP_LISTEN=:80\n" +
+		"TEST_HTTP_PORT=0\n"
+	if got := c.ExportEnv(false); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// exported variables load the same values
+	t.Setenv("TEST_SMTP_PASSWORD", "")
+	for _, l := range []struct{ name, value string }{
+		{"TEST_SMTP_HOST", "mail.com"},
+		{"TEST_SMTP_PASSWORD", "s3cr3t"},
+		{"TEST_SMTP_TIMEOUT", "1m0s"},
+		{"TEST_SMTP_TOKENS", "a,b"},
+		{"TEST_SMTP_HEADERS", "X-A:a,X-B:b"},
+		{"TEST_SMTP_NOTE", `say "hi" # now`},
+	} {
+		t.Setenv(l.name, l.value)
+	}
+	o := &exportOptions{Internal: "internal"}
+	n := config.New("test")
+	n.Register("smtp", o)
+	if err := n.Load(); err != nil {
+		t.Fatal(err)
+	}
+	want2 := &exportOptions{
+		Host:     "mail.com",
+		Password: "s3cr3t",
+		Timeout:  time.Minute,
+		Tokens:   []string{"a", "b"},
+		Headers:  map[string]string{"X-B": "b", "X-A": "a"},
+		Note:     `say "hi" # now`,
+		Internal: "internal",
+	}
+	// envconfig allocates nil pointers to structs
+	o.TLS = nil
+	if !reflect.DeepEqual(o, want2) {
+		t.Errorf("got %+v, want %+v", o, want2)
+	}
+}
+
+func TestConfig_ExportEnv_dotenvFile(t *testing.T) {
+	want := &exportOptions{
+		Host:     "mail.com",
+		Password: "s3cr3t",
+		Timeout:  time.Minute,
+		Tokens:   []string{"a", "b"},
+		Headers:  map[string]string{"X-B": "b", "X-A": "a"},
+		Note:     `say "hi" # now`,
+	}
+	c := config.New("test")
+	c.Register("smtp", want)
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "smtp.env"), c.ExportEnv(true))
+
+	o := &exportOptions{}
+	n := config.New("test", dir)
+	n.UnknownKeys = config.Fail
+	n.Register("smtp", o)
+	if err := n.Load(); err != nil {
+		t.Fatal(err)
+	}
+	// envconfig allocates nil pointers to structs
+	o.TLS = nil
+	if !reflect.DeepEqual(o, want) {
+		t.Errorf("got %+v, want %+v", o, want)
+	}
+	if got, want := n.Origin("smtp", "host").String(), filepath.Join(dir, "smtp.env")+":2:1"; got != want {
+		t.Errorf("got origin %q, want %q", got, want)
+	}
+}
+
+func TestConfig_ExportJSON(t *testing.T) {
+	c := newExportConfig()
+
+	got, err := c.ExportJSON("smtp", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "headers": {
+    "X-A": "a",
+    "X-B": "b"
+  },
+  "host": "mail.com",
+  "note": "say \"hi\" # now",
+  "password": "******",
+  "timeout": 60000000000,
+  "tls": null,
+  "tokens": [
+    "a",
+    "b"
+  ]
+}
+`
+	if string(got) != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	got, err = c.ExportJSON("smtp", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"password": "s3cr3t"`; !strings.Contains(string(got), want) {
+		t.Errorf("got\n%s\nwithout %s", got, want)
+	}
+
+	if _, err := c.ExportJSON("api", false); err == nil {
+		t.Error("got no error for unknown options")
+	}
+}
+
+func TestConfig_ExportKubernetes(t *testing.T) {
+	c := newExportConfig()
+
+	got, err := c.ExportKubernetes("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `apiVersion: v1
+kind: ConfigMap
+metadata:
+    name: app
+data:
+    TEST_HTTP_LISTEN: :80
+    TEST_HTTP_PORT: "0"
+    TEST_SMTP_HEADERS: X-A:a,X-B:b
+    TEST_SMTP_HOST: mail.com
+    TEST_SMTP_NOTE: 'say "hi" # now'
+    TEST_SMTP_TIMEOUT: 1m0s
+    TEST_SMTP_TOKENS: a,b
+---
+apiVersion: v1
+kind: Secret
+metadata:
+    name: app
+type: Opaque
+stringData:
+    TEST_SMTP_PASSWORD: s3cr3t
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestConfig_ExportKubernetes_redacter(t *testing.T) {
+	c := config.New("test")
+	c.Register("secret", &secretOptions{
+		Username: "admin",
+		Headers:  map[string]string{"Authorization": "Bearer t0k3n"},
+	})
+
+	got, err := c.ExportKubernetes("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `apiVersion: v1
+kind: ConfigMap
+metadata:
+    name: app
+data:
+    TEST_SECRET_USERNAME: admin
+---
+apiVersion: v1
+kind: Secret
+metadata:
+    name: app
+type: Opaque
+stringData:
+    TEST_SECRET_EMPTY: ""
+    TEST_SECRET_HEADERS: Authorization:Bearer t0k3n
+    TEST_SECRET_PASSWORD: ""
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"encoding"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kelseyhightower/envconfig"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// field describes an exported field of an options struct with keys under
+// which its value can be set in configuration files and environment
+// variables.
+type field struct {
+	// name of the field in go code
+	name string
+	// yaml key, empty if the field is skipped by yaml
+	key string
+	// json key, empty if the field is skipped by json
+	jsonKey string
+	// yaml keys from the options root to this field, joined by a dot
+	path string
+	// names of the environment variables as envconfig resolves them, empty
+	// if the field is ignored
+	envKey string
+	envAlt string
+	// index sequence for reflect.Value.FieldByIndex
+	index []int
+	typ   reflect.Type
+	tag   reflect.StructTag
+	// fields of a nested struct
+	fields []*field
+}
+
+// leaf returns true if the value of the field is not a nested struct.
+func (f *field) leaf() bool {
+	return f.fields == nil
+}
+
+// optionsFields returns fields of the options struct with environment
+// variable names prefixed with envPrefix.
+func optionsFields(o interface{}, envPrefix string) []*field {
+	t := reflect.TypeOf(o)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	return structFields(t, nil, "", envPrefix)
+}
+
+func structFields(t reflect.Type, index []int, path, envPrefix string) (fields []*field) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		yamlName, yamlFlags, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		inline := strings.Contains(","+yamlFlags+",", ",inline,")
+		if sf.PkgPath != "" && !(sf.Anonymous && inline) {
+			continue
+		}
+
+		f := &field{
+			name:  sf.Name,
+			index: append(append([]int{}, index...), i),
+			typ:   sf.Type,
+			tag:   sf.Tag,
+		}
+
+		switch yamlName {
+		case "-":
+		case "":
+			f.key = strings.ToLower(sf.Name)
+		default:
+			f.key = yamlName
+		}
+		switch jsonName, _, _ := strings.Cut(sf.Tag.Get("json"), ","); jsonName {
+		case "-":
+		case "":
+			f.jsonKey = sf.Name
+		default:
+			f.jsonKey = jsonName
+		}
+		key := f.key
+		if key == "" {
+			key = strings.ToLower(sf.Name)
+		}
+		f.path = key
+		if path != "" {
+			f.path = path + "." + key
+		}
+
+		if !isTrue(sf.Tag.Get("ignored")) {
+			f.envAlt = strings.ToUpper(sf.Tag.Get("envconfig"))
+			f.envKey = sf.Name
+			if isTrue(sf.Tag.Get("split_words")) {
+				f.envKey = splitWords(sf.Name)
+			}
+			if f.envAlt != "" {
+				f.envKey = f.envAlt
+			}
+			if envPrefix != "" {
+				f.envKey = envPrefix + "_" + f.envKey
+			}
+			f.envKey = strings.ToUpper(f.envKey)
+		}
+
+		if st := structType(sf.Type); st != nil {
+			childPath, childEnvPrefix := f.path, f.envKey
+			if inline {
+				childPath = path
+			}
+			if sf.Anonymous {
+				childEnvPrefix = envPrefix
+			}
+			f.fields = structFields(st, f.index, childPath, childEnvPrefix)
+			if f.fields == nil {
+				f.fields = []*field{}
+			}
+			if inline {
+				fields = append(fields, f.fields...)
+				continue
+			}
+		}
+
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	yamlUnmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+	envDecoderType      = reflect.TypeOf((*envconfig.Decoder)(nil)).Elem()
+	envSetterType       = reflect.TypeOf((*envconfig.Setter)(nil)).Elem()
+)
+
+// structType returns the struct type if t is a struct or a pointer to a
+// struct that does not decode its value by itself.
+func structType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	p := reflect.PointerTo(t)
+	for _, i := range []reflect.Type{textUnmarshalerType, yamlUnmarshalerType, envDecoderType, envSetterType} {
+		if p.Implements(i) {
+			return nil
+		}
+	}
+	return t
+}
+
+// leafFields returns all fields in the tree that are not nested structs.
+func leafFields(fields []*field) (leafs []*field) {
+	for _, f := range fields {
+		if f.leaf() {
+			leafs = append(leafs, f)
+			continue
+		}
+		leafs = append(leafs, leafFields(f.fields)...)
+	}
+	return leafs
+}
+
+// fieldByKey returns a field that matches a key in a configuration file.
+// Json keys are matched as encoding/json does, preferring the exact match
+// over the case insensitive one.
+func fieldByKey(fields []*field, key string, json bool) *field {
+	if !json {
+		for _, f := range fields {
+			if f.key != "" && f.key == key {
+				return f
+			}
+		}
+		return nil
+	}
+	for _, f := range fields {
+		if f.jsonKey != "" && f.jsonKey == key {
+			return f
+		}
+	}
+	for _, f := range fields {
+		if f.jsonKey != "" && strings.EqualFold(f.jsonKey, key) {
+			return f
+		}
+	}
+	return nil
+}
+
+// walkMapping calls fn for every key in mapping node n. Argument f is the
+// options field that the key corresponds to, or nil if there is no such
+// field. Values of nested struct fields are walked recursively and fn is
+// not called for their keys.
+func walkMapping(n *yaml.Node, fields []*field, json bool, fn func(f *field, key, value *yaml.Node)) {
+	n = resolveNode(n)
+	if n == nil || n.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		f := fieldByKey(fields, key.Value, json)
+		if f != nil && !f.leaf() {
+			if v := resolveNode(value); v != nil && v.Kind == yaml.MappingNode {
+				walkMapping(v, f.fields, json, fn)
+				continue
+			}
+		}
+		fn(f, key, value)
+	}
+}
+
+// resolveNode returns the content of document nodes and targets of alias
+// nodes.
+func resolveNode(n *yaml.Node) *yaml.Node {
+	for n != nil {
+		switch n.Kind {
+		case yaml.DocumentNode:
+			if len(n.Content) == 0 {
+				return nil
+			}
+			n = n.Content[0]
+		case yaml.AliasNode:
+			n = n.Alias
+		default:
+			return n
+		}
+	}
+	return nil
+}
+
+var (
+	gatherRegexp  = regexp.MustCompile("([^A-Z]+|[A-Z]+[^A-Z]+|[A-Z]+)")
+	acronymRegexp = regexp.MustCompile("([A-Z]+)([A-Z][^A-Z]+)")
+)
+
+// splitWords returns the environment variable name for a field with the
+// split_words tag in the same way as envconfig does.
+func splitWords(name string) string {
+	words := gatherRegexp.FindAllStringSubmatch(name, -1)
+	if len(words) == 0 {
+		return name
+	}
+	var parts []string
+	for _, words := range words {
+		if m := acronymRegexp.FindStringSubmatch(words[0]); len(m) == 3 {
+			parts = append(parts, m[1], m[2])
+		} else {
+			parts = append(parts, words[0])
+		}
+	}
+	return strings.Join(parts, "_")
+}
+
+func isTrue(s string) bool {
+	b, _ := strconv.ParseBool(s)
+	return b
+}
+
+// envPrefix returns the prefix that is used for environment variables of
+// the named options.
+func (c *Config) envPrefix(name string) string {
+	prefix := strings.Replace(c.Name, "-", "_", -1)
+	if !strings.EqualFold(c.Name, name) {
+		prefix += "_" + name
+	}
+	return prefix
+}
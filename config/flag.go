@@ -0,0 +1,153 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// BindFlags defines flags in the flag set for all fields of registered
+// options. Flag names are options names and yaml keys of fields joined by
+// a dot, like http.listen or http.tls.cert. Values of flags that are set
+// on the command line are applied by Load and Reload after configuration
+// files and environment variables, overriding them. Values of slices and
+// maps are comma separated as in environment variables and slice flags can
+// be repeated to append values. Usage of a flag is the value of the
+// description struct tag.
+//
+// Options must be registered before BindFlags is called.
+func (c *Config) BindFlags(fs *flag.FlagSet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.flags == nil {
+		c.flags = make(map[string][]*flagValue)
+	}
+	for _, o := range c.options {
+		fields := optionsFields(o.o, "")
+		n, err := redactedNode(o.o, fields)
+		if err != nil {
+			n = nil
+		}
+		paths := make(map[string][]*field)
+		fieldPaths(fields, nil, paths)
+		for _, f := range leafFields(fields) {
+			if f.key == "" {
+				continue
+			}
+			v := &flagValue{
+				name: o.name + "." + f.path,
+				path: paths[f.path],
+			}
+			if d := lookupNode(n, fields, f.path, false); d != nil {
+				v.def = referenceValue(d)
+			}
+			fs.Var(v, v.name, f.tag.Get("description"))
+			c.flags[o.name] = append(c.flags[o.name], v)
+		}
+	}
+}
+
+// fieldPaths maps yaml paths of leaf fields to the sequence of fields from
+// the options root.
+func fieldPaths(fields, parents []*field, paths map[string][]*field) {
+	for _, f := range fields {
+		if f.key == "" {
+			continue
+		}
+		path := append(append([]*field{}, parents...), f)
+		if !f.leaf() {
+			fieldPaths(f.fields, path, paths)
+			continue
+		}
+		paths[f.path] = path
+	}
+}
+
+// applyFlags sets values of flags that are set for the named options to o
+// and records their origins.
+func (c *Config) applyFlags(name string, o Options, origins map[string]Origin) error {
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, v := range c.flags[name] {
+		if !v.set {
+			continue
+		}
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str"}
+		setPath(root, v.path, false, key, v.node())
+		origins[v.field().path] = Origin{Flag: v.name}
+	}
+	if len(root.Content) == 0 {
+		return nil
+	}
+	if err := root.Decode(o); err != nil {
+		return fmt.Errorf("load %q flags: %w", name, err)
+	}
+	return nil
+}
+
+// flagValue implements flag.Value for a single options field.
+type flagValue struct {
+	name string
+	// fields from the options root to the field that the flag sets
+	path   []*field
+	def    string
+	values []string
+	set    bool
+}
+
+func (v *flagValue) field() *field {
+	return v.path[len(v.path)-1]
+}
+
+// node returns the yaml node of the value in the same form as environment
+// variables values are interpreted.
+func (v *flagValue) node() *yaml.Node {
+	return envValueNode(v.field(), strings.Join(v.values, ","), 0, 0)
+}
+
+func (v *flagValue) String() string {
+	if v == nil || len(v.path) == 0 {
+		return ""
+	}
+	if v.set {
+		return strings.Join(v.values, ",")
+	}
+	return v.def
+}
+
+// Set validates the value by decoding it into a new value of the field
+// type. Values of repeated slice flags are appended.
+func (v *flagValue) Set(s string) error {
+	values := []string{s}
+	if v.set && v.kind() == reflect.Slice {
+		values = append(append([]string{}, v.values...), s)
+	}
+	n := envValueNode(v.field(), strings.Join(values, ","), 0, 0)
+	if err := n.Decode(reflect.New(v.field().typ).Interface()); err != nil {
+		return fmt.Errorf("invalid %s value", v.field().typ)
+	}
+	v.values = values
+	v.set = true
+	return nil
+}
+
+// IsBoolFlag allows boolean flags to be set without a value.
+func (v *flagValue) IsBoolFlag() bool {
+	return v.kind() == reflect.Bool
+}
+
+func (v *flagValue) kind() reflect.Kind {
+	t := v.field().typ
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind()
+}
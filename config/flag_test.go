@@ -0,0 +1,95 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"flag"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"resenje.org/x/config"
+)
+
+type flagOptions struct {
+	Listen  string        `yaml:"listen" description:"Address to listen on."`
+	Debug   bool          `yaml:"debug"`
+	Timeout time.Duration `yaml:"timeout"`
+	Domains []string      `yaml:"domains"`
+	TLS     struct {
+		Cert string `yaml:"cert"`
+	} `yaml:"tls"`
+}
+
+func (o *flagOptions) VerifyAndPrepare() error { return nil }
+
+func TestConfig_BindFlags(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "http.yaml"), "listen: :80\ntimeout: 10s\n")
+	t.Setenv("TEST_HTTP_TIMEOUT", "20s")
+
+	o := &flagOptions{Listen: ":8080"}
+	c := config.New("test", dir)
+	c.Register("http", o)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	c.BindFlags(fs)
+
+	if f := fs.Lookup("http.listen"); f == nil || f.DefValue != ":8080" || f.Usage != "Address to listen on." {
+		t.Fatalf("got flag %+v", f)
+	}
+
+	if err := fs.Parse([]string{
+		"-http.timeout=1m",
+		"-http.domains=a.com,b.com",
+		"-http.domains=c.com",
+		"-http.debug",
+		"-http.tls.cert=cert.pem",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &flagOptions{
+		Listen:  ":80",
+		Debug:   true,
+		Timeout: time.Minute,
+		Domains: []string{"a.com", "b.com", "c.com"},
+	}
+	want.TLS.Cert = "cert.pem"
+	if !reflect.DeepEqual(o, want) {
+		t.Errorf("got %+v, want %+v", o, want)
+	}
+
+	for key, origin := range map[string]string{
+		"listen":   filepath.Join(dir, "http.yaml") + ":1:1",
+		"timeout":  "flag http.timeout",
+		"tls.cert": "flag http.tls.cert",
+	} {
+		if got := c.Origin("http", key).String(); got != origin {
+			t.Errorf("got %s origin %q, want %q", key, got, origin)
+		}
+	}
+}
+
+func TestConfig_BindFlags_invalid(t *testing.T) {
+	c := config.New("test")
+	c.Register("http", &flagOptions{})
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	c.BindFlags(fs)
+
+	err := fs.Parse([]string{"-http.timeout=soon"})
+	if err == nil || !strings.Contains(err.Error(), "invalid time.Duration value") {
+		t.Errorf("got error %v", err)
+	}
+}
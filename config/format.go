@@ -0,0 +1,483 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Format parses configuration files of a specific type.
+type Format interface {
+	// Decode parses the file data into a yaml node tree with mapping keys
+	// that correspond to yaml struct tags of options o. Line and column
+	// of nodes are used to report errors and origins of values. Decode
+	// returns a nil node if there are no values in the data.
+	Decode(filename string, data []byte, o Options) (*yaml.Node, error)
+}
+
+// FormatFunc implements Format as a single function that can be assigned.
+type FormatFunc func(filename string, data []byte, o Options) (*yaml.Node, error)
+
+// Decode calls the type function.
+func (f FormatFunc) Decode(filename string, data []byte, o Options) (*yaml.Node, error) {
+	return f(filename, data, o)
+}
+
+// Built-in formats.
+var (
+	YAML   Format = yamlFormat{}
+	JSON   Format = jsonFormat{}
+	TOML   Format = tomlFormat{}
+	Dotenv Format = dotenvFormat{}
+)
+
+type format struct {
+	ext string
+	Format
+}
+
+// defaultFormats are file extensions and formats that Load reads from every
+// configuration directory, in this order.
+var defaultFormats = []format{
+	{ext: ".yaml", Format: YAML},
+	{ext: ".json", Format: JSON},
+	{ext: ".toml", Format: TOML},
+	{ext: ".env", Format: Dotenv},
+}
+
+// RegisterFormat adds a format for files with the extension ext, like
+// ".hcl". Load reads files in every configuration directory for built-in
+// formats first and then for registered formats in the order of
+// registration. Registering a format for the extension that already has a
+// format replaces it, keeping its position.
+func (c *Config) RegisterFormat(ext string, f Format) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.formatList == nil {
+		c.formatList = append([]format{}, defaultFormats...)
+	}
+	for i := range c.formatList {
+		if c.formatList[i].ext == ext {
+			c.formatList[i].Format = f
+			return
+		}
+	}
+	c.formatList = append(c.formatList, format{ext: ext, Format: f})
+}
+
+func (c *Config) formats() []format {
+	if c.formatList == nil {
+		return defaultFormats
+	}
+	return c.formatList
+}
+
+// document is a parsed configuration file.
+type document struct {
+	filename string
+	// kind is the file extension without the dot, used in error messages
+	kind string
+	node *yaml.Node
+	// keys and values are in json format and are decoded with encoding/json
+	json bool
+	// index of the layer that the document is read from
+	layer int
+}
+
+// decode sets values from the document to options o.
+func (d *document) decode(o interface{}) error {
+	if d.json {
+		data, err := nodeJSON(d.node)
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", d.filename, err)
+		}
+		if err := json.Unmarshal(data, o); err != nil {
+			var e *json.UnmarshalTypeError
+			if errors.As(err, &e) {
+				if errs := jsonTypeErrors(d.filename, d.node, o); len(errs) > 0 {
+					return errs
+				}
+			}
+			return fmt.Errorf("parse %s: %w", d.filename, err)
+		}
+		return nil
+	}
+	if err := d.node.Decode(o); err != nil {
+		var e *yaml.TypeError
+		if errors.As(err, &e) {
+			if errs := yamlTypeErrors(d.filename, d.node, o); len(errs) > 0 {
+				return errs
+			}
+		}
+		return yamlErrors(d.filename, err)
+	}
+	return nil
+}
+
+type yamlFormat struct{}
+
+func (yamlFormat) Decode(filename string, data []byte, _ Options) (*yaml.Node, error) {
+	var n yaml.Node
+	if err := yaml.Unmarshal(data, &n); err != nil {
+		return nil, yamlErrors(filename, err)
+	}
+	if n.Kind == 0 {
+		return nil, nil
+	}
+	return &n, nil
+}
+
+type jsonFormat struct{}
+
+func (jsonFormat) Decode(filename string, data []byte, _ Options) (*yaml.Node, error) {
+	n, err := jsonNode(data)
+	if err != nil {
+		getLineColFromOffset := func(data []byte, offset int64) (line, col int) {
+			start := bytes.LastIndex(data[:offset], []byte{10}) + 1
+			return bytes.Count(data[:start], []byte{10}) + 1, int(offset) - start
+		}
+		var e *json.SyntaxError
+		if errors.As(err, &e) {
+			line, col := getLineColFromOffset(data, e.Offset)
+			return nil, FileErrors{{File: filename, Line: line, Column: col, Err: err}}
+		}
+		return nil, fmt.Errorf("parse %s: %w", filename, err)
+	}
+	return n, nil
+}
+
+// nodeJSON encodes the yaml node tree as json.
+func nodeJSON(n *yaml.Node) ([]byte, error) {
+	v, err := nodeValue(n)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func nodeValue(n *yaml.Node) (interface{}, error) {
+	n = resolveNode(n)
+	if n == nil {
+		return nil, nil
+	}
+	switch n.Kind {
+	case yaml.MappingNode:
+		m := make(map[string]interface{}, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			v, err := nodeValue(n.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			m[n.Content[i].Value] = v
+		}
+		return m, nil
+	case yaml.SequenceNode:
+		s := make([]interface{}, 0, len(n.Content))
+		for _, c := range n.Content {
+			v, err := nodeValue(c)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, v)
+		}
+		return s, nil
+	}
+	switch n.ShortTag() {
+	case "!!int", "!!float":
+		if json.Valid([]byte(n.Value)) {
+			return json.Number(n.Value), nil
+		}
+	case "!!bool", "!!null":
+		var v interface{}
+		if err := n.Decode(&v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	return n.Value, nil
+}
+
+// jsonTypeErrors decodes values from the node tree into every options
+// field separately in order to collect decoding errors with positions of
+// values that caused them.
+func jsonTypeErrors(filename string, n *yaml.Node, o interface{}) (errs FileErrors) {
+	walkMapping(n, optionsFields(o, ""), true, func(f *field, _, value *yaml.Node) {
+		if f == nil {
+			return
+		}
+		data, err := nodeJSON(value)
+		if err != nil {
+			return
+		}
+		var e *json.UnmarshalTypeError
+		if !errors.As(json.Unmarshal(data, reflect.New(f.typ).Interface()), &e) {
+			return
+		}
+		errs = append(errs, &FileError{
+			File:   filename,
+			Line:   value.Line,
+			Column: value.Column,
+			Err:    fmt.Errorf("expected json %s value but got %s", e.Type, e.Value),
+		})
+	})
+	return errs
+}
+
+type tomlFormat struct{}
+
+func (tomlFormat) Decode(filename string, data []byte, _ Options) (*yaml.Node, error) {
+	var m map[string]interface{}
+	if _, err := toml.Decode(string(data), &m); err != nil {
+		var e toml.ParseError
+		if errors.As(err, &e) {
+			msg := e.Message
+			if msg == "" {
+				msg = e.Error()
+			}
+			_, col := lineCol(data, int64(e.Position.Start))
+			return nil, FileErrors{{File: filename, Line: e.Position.Line, Column: col, Err: errors.New(msg)}}
+		}
+		return nil, fmt.Errorf("parse %s: %w", filename, err)
+	}
+	if len(m) == 0 {
+		return nil, nil
+	}
+	// toml package does not expose positions of keys, so only the file is
+	// known for values
+	var n yaml.Node
+	if err := n.Encode(m); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filename, err)
+	}
+	return &n, nil
+}
+
+// dotenvFormat parses files with environment variables. Variable names are
+// the same as the ones that envconfig uses for options fields, with the
+// prefix of options, like MYAPP_HTTP_LISTEN, or without it, like LISTEN.
+// Values of slices are comma separated and values of maps are comma
+// separated key:value pairs.
+type dotenvFormat struct {
+	// prefix is the environment variables prefix of options, set when
+	// files of the named options are loaded
+	prefix string
+}
+
+func (d dotenvFormat) Decode(filename string, data []byte, o Options) (*yaml.Node, error) {
+	fields := make(map[string][]*field)
+	envFieldPaths(optionsFields(o, ""), nil, fields)
+	if d.prefix != "" {
+		envFieldPaths(optionsFields(o, d.prefix), nil, fields)
+	}
+
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: 1, Column: 1}
+	var errs FileErrors
+	r := bufio.NewReader(bytes.NewReader(data))
+	for line := 1; ; line++ {
+		l, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("read %s: %w", filename, err)
+		}
+		if name, value, col, ok, perr := parseDotenvLine(l); perr != nil {
+			errs = append(errs, &FileError{File: filename, Line: line, Column: col, Err: perr})
+		} else if ok {
+			key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name, Line: line, Column: col}
+			path, ok := fields[name]
+			if !ok {
+				root.Content = append(root.Content, key, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, Line: line, Column: col})
+				continue
+			}
+			setPath(root, path, false, key, envValueNode(path[len(path)-1], value, line, col+len(name)+1))
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if len(root.Content) == 0 {
+		return nil, nil
+	}
+	return root, nil
+}
+
+// envFieldPaths maps environment variable names of fields to the sequence
+// of fields from the options root.
+func envFieldPaths(fields, parents []*field, paths map[string][]*field) {
+	for _, f := range fields {
+		if f.key == "" {
+			continue
+		}
+		path := append(append([]*field{}, parents...), f)
+		if !f.leaf() {
+			envFieldPaths(f.fields, path, paths)
+			continue
+		}
+		if f.envKey == "" {
+			continue
+		}
+		paths[f.envKey] = path
+		if f.envAlt != "" {
+			paths[f.envAlt] = path
+		}
+	}
+}
+
+// setPath sets the value in nested mapping nodes under keys of fields,
+// json keys if json is true, or yaml keys.
+func setPath(n *yaml.Node, path []*field, json bool, key, value *yaml.Node) {
+	fieldKey := func(f *field) string {
+		if json {
+			return f.jsonKey
+		}
+		return f.key
+	}
+	for _, f := range path[:len(path)-1] {
+		var next *yaml.Node
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == fieldKey(f) && n.Content[i+1].Kind == yaml.MappingNode {
+				next = n.Content[i+1]
+				break
+			}
+		}
+		if next == nil {
+			next = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: key.Line, Column: key.Column}
+			n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: fieldKey(f), Line: key.Line, Column: key.Column}, next)
+		}
+		n = next
+	}
+	key.Value = fieldKey(path[len(path)-1])
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key.Value {
+			n.Content[i], n.Content[i+1] = key, value
+			return
+		}
+	}
+	n.Content = append(n.Content, key, value)
+}
+
+// envValueNode creates a yaml node from the string value in the same way
+// as envconfig interprets values for fields of different types.
+func envValueNode(f *field, value string, line, col int) *yaml.Node {
+	scalar := func(t reflect.Type, v string) *yaml.Node {
+		n := &yaml.Node{Kind: yaml.ScalarNode, Value: v, Line: line, Column: col}
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.String {
+			n.Tag = "!!str"
+		}
+		return n
+	}
+	t := f.typ
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if structType(f.typ) == nil && !reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		switch {
+		case t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8:
+			n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: line, Column: col}
+			if value != "" {
+				for _, v := range strings.Split(value, ",") {
+					n.Content = append(n.Content, scalar(t.Elem(), v))
+				}
+			}
+			return n
+		case t.Kind() == reflect.Map:
+			n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: line, Column: col}
+			if value != "" {
+				for _, pair := range strings.Split(value, ",") {
+					k, v, _ := strings.Cut(pair, ":")
+					n.Content = append(n.Content, scalar(t.Key(), k), scalar(t.Elem(), v))
+				}
+			}
+			return n
+		}
+	}
+	return scalar(t, value)
+}
+
+// parseDotenvLine parses a single line of a dotenv file. It supports
+// comments, the export keyword, single quoted literal values and double
+// quoted values with escape sequences.
+func parseDotenvLine(l string) (name, value string, col int, ok bool, err error) {
+	s := strings.TrimRight(l, "\r\n")
+	trimmed := strings.TrimLeft(s, " \t")
+	col = len(s) - len(trimmed) + 1
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return "", "", 0, false, nil
+	}
+	if rest, found := strings.CutPrefix(trimmed, "export "); found {
+		rest = strings.TrimLeft(rest, " \t")
+		col += len(trimmed) - len(rest)
+		trimmed = rest
+	}
+	name, value, found := strings.Cut(trimmed, "=")
+	if !found {
+		return "", "", col, false, errors.New("missing =")
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", "", col, false, errors.New("missing variable name")
+	}
+	value = strings.TrimSpace(value)
+	switch {
+	case strings.HasPrefix(value, "'"):
+		end := strings.Index(value[1:], "'")
+		if end < 0 {
+			return "", "", col, false, errors.New("unterminated single quoted value")
+		}
+		value = value[1 : end+1]
+	case strings.HasPrefix(value, `"`):
+		var b strings.Builder
+		escaped, closed := false, false
+		for _, r := range value[1:] {
+			if escaped {
+				switch r {
+				case 'n':
+					b.WriteRune('\n')
+				case 't':
+					b.WriteRune('\t')
+				case 'r':
+					b.WriteRune('\r')
+				default:
+					b.WriteRune(r)
+				}
+				escaped = false
+				continue
+			}
+			if r == '\\' {
+				escaped = true
+				continue
+			}
+			if r == '"' {
+				closed = true
+				break
+			}
+			b.WriteRune(r)
+		}
+		if !closed {
+			return "", "", col, false, errors.New("unterminated double quoted value")
+		}
+		value = b.String()
+	default:
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+	}
+	return name, value, col, true, nil
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	yaml "gopkg.in/yaml.v3"
+	"resenje.org/x/config"
+)
+
+func TestConfig_Load_formats(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(dir, "http.yaml"), "listen: :80\nport: 80\n")
+	writeFile(t, filepath.Join(dir, "http.json"), `{"port": 81}`)
+	writeFile(t, filepath.Join(dir, "http.toml"), "port = 82\ndomains = [\"example.com\"]\n")
+	writeFile(t, filepath.Join(dir, "http.env"), "# comment\nexport PORT=83\nDOMAINS='example.com,example.org'\n")
+
+	o := &testOptions{}
+	c := config.New("test", dir)
+	c.Register("http", o)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &testOptions{
+		Listen:  ":80",
+		Port:    83,
+		Domains: []string{"example.com", "example.org"},
+	}
+	if !reflect.DeepEqual(o, want) {
+		t.Errorf("got %+v, want %+v", o, want)
+	}
+	if got, want := c.Origin("http", "port").String(), filepath.Join(dir, "http.env")+":2:8"; got != want {
+		t.Errorf("got port origin %q, want %q", got, want)
+	}
+	if got, want := c.Origin("http", "listen").String(), filepath.Join(dir, "http.yaml")+":1:1"; got != want {
+		t.Errorf("got listen origin %q, want %q", got, want)
+	}
+}
+
+func TestConfig_RegisterFormat(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(dir, "http.yaml"), "port: 80\n")
+	writeFile(t, filepath.Join(dir, "http.ini"), "port=8080\nlisten=:8080\n")
+
+	ini := config.FormatFunc(func(filename string, data []byte, _ config.Options) (*yaml.Node, error) {
+		n := &yaml.Node{Kind: yaml.MappingNode}
+		for i, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			key, value, _ := strings.Cut(line, "=")
+			n.Content = append(n.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Value: key, Line: i + 1, Column: 1},
+				&yaml.Node{Kind: yaml.ScalarNode, Value: value, Line: i + 1, Column: len(key) + 2},
+			)
+		}
+		return n, nil
+	})
+
+	o := &testOptions{}
+	c := config.New("test", dir)
+	c.RegisterFormat(".ini", ini)
+	c.Register("http", o)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if o.Port != 8080 {
+		t.Errorf("got port %v, want %v", o.Port, 8080)
+	}
+	if o.Listen != ":8080" {
+		t.Errorf("got listen %q, want %q", o.Listen, ":8080")
+	}
+}
+
+func TestConfig_Load_formatErrors(t *testing.T) {
+	for _, tc := range []struct {
+		file string
+		data string
+		want string
+	}{
+		{
+			file: "http.json",
+			data: "{\n  \"port\": \"eighty\"\n}",
+			want: ":2:11: expected json int value but got string",
+		},
+		{
+			file: "http.json",
+			data: "{\n  \"port\": 80,\n}",
+			want: ":3:1: invalid character '}' looking for beginning of object key string",
+		},
+		{
+			file: "http.toml",
+			data: "port = \"eighty\"\n",
+			want: ": cannot unmarshal !!str `eighty` into int",
+		},
+		{
+			file: "http.env",
+			data: "PORT=80\nLISTEN\n",
+			want: ":2:1: missing =",
+		},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			dir := t.TempDir()
+			filename := filepath.Join(dir, tc.file)
+			writeFile(t, filename, tc.data)
+
+			c := config.New("test", dir)
+			c.Register("http", &testOptions{})
+
+			err := c.Load()
+			var errs config.FileErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("got error %v, want %T", err, errs)
+			}
+			if got, want := errs.Error(), filename+tc.want; got != want {
+				t.Errorf("got error %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestConfig_Load_fs(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(dir, "http.yaml"), "port: 8080\n")
+
+	o := &testOptions{}
+	c := config.New("test", dir)
+	c.FS = []fs.FS{
+		fstest.MapFS{
+			"http.yaml": {Data: []byte("listen: :80\nport: 80\n")},
+		},
+		fstest.MapFS{
+			"http.json": {Data: []byte(`{"domains": ["example.com"]}`)},
+		},
+	}
+	c.Register("http", o)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &testOptions{
+		Listen:  ":80",
+		Port:    8080,
+		Domains: []string{"example.com"},
+	}
+	if !reflect.DeepEqual(o, want) {
+		t.Errorf("got %+v, want %+v", o, want)
+	}
+	if got, want := c.Origin("http", "listen").String(), "http.yaml:1:1"; got != want {
+		t.Errorf("got listen origin %q, want %q", got, want)
+	}
+}
+
+func TestConfig_Load_profile(t *testing.T) {
+	dir1 := t.TempDir()
+	dir2 := t.TempDir()
+
+	writeFile(t, filepath.Join(dir1, "http.yaml"), "listen: :80\nport: 80\n")
+	writeFile(t, filepath.Join(dir1, "http.production.yaml"), "port: 443\n")
+	writeFile(t, filepath.Join(dir2, "http.yaml"), "port: 8080\n")
+	writeFile(t, filepath.Join(dir2, "http.production.json"), `{"domains": ["example.com"]}`)
+	writeFile(t, filepath.Join(dir2, "http.staging.json"), `{"domains": ["staging.example.com"]}`)
+
+	for _, tc := range []struct {
+		name    string
+		profile string
+		env     string
+		want    *testOptions
+	}{
+		{
+			name: "none",
+			want: &testOptions{Listen: ":80", Port: 8080},
+		},
+		{
+			name:    "field",
+			profile: "production",
+			env:     "staging",
+			want:    &testOptions{Listen: ":80", Port: 8080, Domains: []string{"example.com"}},
+		},
+		{
+			name: "env",
+			env:  "staging",
+			want: &testOptions{Listen: ":80", Port: 8080, Domains: []string{"staging.example.com"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &testOptions{}
+			c := config.New("my-app", dir1, dir2)
+			c.Profile = tc.profile
+			t.Setenv("MY_APP_PROFILE", tc.env)
+			c.Register("http", o)
+			if err := c.Load(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(o, tc.want) {
+				t.Errorf("got %+v, want %+v", o, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,356 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTP returns a layer that fetches configuration files of options, like
+// http.yaml or http.json, from the base URL, caching them in the cache
+// directory, which is not used if it is empty.
+func HTTP(baseURL, cacheDir string) Layer {
+	return FileSystem(&HTTPFS{URL: baseURL, CacheDir: cacheDir})
+}
+
+// HTTPFS is a file system with configuration files that are fetched from
+// a remote configuration service under the base URL. Files are requested
+// with If-None-Match header with the ETag of the previous response, so
+// that Watch polls for changes cheaply. If the service is not available,
+// the last fetched files are used, also from the cache directory after
+// restarts, and files that were never fetched are considered as not
+// existing only if the service responded that they were not found. Files
+// can not be listed, so fragment directories are not supported. A file
+// fetched by Stat is returned by the next Open or ReadFile of the same file
+// without another request.
+type HTTPFS struct {
+	// URL is the base URL to which file names are appended.
+	URL string
+	// Client is used for requests. If it is nil, a client with
+	// DefaultHTTPTimeout is used.
+	Client *http.Client
+	// CacheDir is the directory where fetched files are stored. If it is
+	// empty, files are cached only in memory.
+	CacheDir string
+	// Logger reports that cached files are used because the service is not
+	// available. If it is nil, slog.Default() is used.
+	Logger *slog.Logger
+
+	mu    sync.Mutex
+	files map[string]*httpFile
+	// stats are files fetched by Stat that are not yet read
+	stats map[string]*httpFile
+	// missing are files that the service did not find
+	missing map[string]bool
+}
+
+// DefaultHTTPTimeout is the timeout of requests of HTTPFS without a Client,
+// so that Load and Watch fall back to cached files if the service does not
+// respond.
+const DefaultHTTPTimeout = 10 * time.Second
+
+var defaultHTTPClient = &http.Client{Timeout: DefaultHTTPTimeout}
+
+type httpFile struct {
+	data    []byte
+	etag    string
+	modTime time.Time
+}
+
+// Open implements fs.FS.
+func (h *HTTPFS) Open(name string) (fs.File, error) {
+	f, err := h.file("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &openHTTPFile{
+		Reader: bytes.NewReader(f.data),
+		info:   f.info(name),
+	}, nil
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (h *HTTPFS) ReadFile(name string) ([]byte, error) {
+	f, err := h.file("read", name)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Clone(f.data), nil
+}
+
+// Stat implements fs.StatFS.
+func (h *HTTPFS) Stat(name string) (fs.FileInfo, error) {
+	f, err := h.file("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return f.info(name), nil
+}
+
+func (h *HTTPFS) file(op, name string) (*httpFile, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	f, err := h.fetch(name, op == "stat")
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return f, nil
+}
+
+// fetch requests the file, returning the cached file if it is not modified
+// or if the request fails. The file fetched for stat is kept for the next
+// read of the file.
+func (h *HTTPFS) fetch(name string, stat bool) (f *httpFile, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if f, ok := h.stats[name]; ok {
+		delete(h.stats, name)
+		if !stat {
+			return f, nil
+		}
+	}
+	if stat {
+		defer func() {
+			if err == nil {
+				if h.stats == nil {
+					h.stats = make(map[string]*httpFile)
+				}
+				h.stats[name] = f
+			}
+		}()
+	}
+
+	cached := h.cached(name)
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(h.URL, "/")+"/"+name, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && cached.etag != "" {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+	client := h.Client
+	if client == nil {
+		client = defaultHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return h.fallback(name, cached, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return h.fallback(name, cached, err)
+		}
+		f := &httpFile{
+			data:    data,
+			etag:    resp.Header.Get("ETag"),
+			modTime: time.Now(),
+		}
+		if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+			f.modTime = t
+		} else if cached != nil && bytes.Equal(cached.data, data) {
+			f.modTime = cached.modTime
+		}
+		h.store(name, f)
+		return f, nil
+	case http.StatusNotModified:
+		if cached == nil {
+			return nil, fmt.Errorf("%s: not modified response without cached file", req.URL)
+		}
+		return cached, nil
+	case http.StatusNotFound:
+		h.remove(name)
+		h.setMissing(name, true)
+		return nil, fs.ErrNotExist
+	}
+	return h.fallback(name, cached, fmt.Errorf("%s: unexpected response status %s", req.URL, resp.Status))
+}
+
+// fallback returns the cached file if the request for it failed. Files that
+// are not cached are considered as not existing only if the service did not
+// find them before, otherwise the error is returned, so that Load does not
+// silently use default values.
+func (h *HTTPFS) fallback(name string, cached *httpFile, err error) (*httpFile, error) {
+	if cached == nil {
+		if h.isMissing(name) {
+			return nil, fmt.Errorf("%w: %w", fs.ErrNotExist, err)
+		}
+		return nil, err
+	}
+	h.logger().Warn("using cached config file", "file", name, "error", err)
+	return cached, nil
+}
+
+func (h *HTTPFS) logger() *slog.Logger {
+	if h.Logger == nil {
+		return slog.Default()
+	}
+	return h.Logger
+}
+
+// cached returns the file from memory or the cache directory, or nil if
+// it is not cached.
+func (h *HTTPFS) cached(name string) *httpFile {
+	if f, ok := h.files[name]; ok {
+		return f
+	}
+	if h.CacheDir == "" {
+		return nil
+	}
+	filename := h.cacheFilename(name)
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil
+	}
+	etag, _ := os.ReadFile(filename + ".etag")
+	f := &httpFile{
+		data:    data,
+		etag:    string(etag),
+		modTime: info.ModTime(),
+	}
+	h.setFile(name, f)
+	return f
+}
+
+func (h *HTTPFS) store(name string, f *httpFile) {
+	h.setFile(name, f)
+	h.setMissing(name, false)
+	if h.CacheDir == "" {
+		return
+	}
+	if err := h.writeCache(name, f); err != nil {
+		h.logger().Warn("cache config file", "file", name, "error", err)
+	}
+}
+
+func (h *HTTPFS) writeCache(name string, f *httpFile) error {
+	if err := os.MkdirAll(h.CacheDir, 0o777); err != nil {
+		return err
+	}
+	filename := h.cacheFilename(name)
+	if err := os.WriteFile(filename, f.data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Chtimes(filename, f.modTime, f.modTime); err != nil {
+		return err
+	}
+	return os.WriteFile(filename+".etag", []byte(f.etag), 0o600)
+}
+
+func (h *HTTPFS) remove(name string) {
+	delete(h.files, name)
+	if h.CacheDir == "" {
+		return
+	}
+	filename := h.cacheFilename(name)
+	for _, n := range []string{filename, filename + ".etag"} {
+		if err := os.Remove(n); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			h.logger().Warn("remove cached config file", "file", name, "error", err)
+		}
+	}
+}
+
+// setMissing records whether the service did not find the file, also in
+// the cache directory, so that it is known after restarts.
+func (h *HTTPFS) setMissing(name string, missing bool) {
+	if m, ok := h.missing[name]; ok && m == missing {
+		return
+	}
+	if h.missing == nil {
+		h.missing = make(map[string]bool)
+	}
+	h.missing[name] = missing
+	if h.CacheDir == "" {
+		return
+	}
+	marker := h.cacheFilename(name) + ".missing"
+	if !missing {
+		if err := os.Remove(marker); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			h.logger().Warn("remove cached config file", "file", name, "error", err)
+		}
+		return
+	}
+	err := os.MkdirAll(h.CacheDir, 0o777)
+	if err == nil {
+		err = os.WriteFile(marker, nil, 0o600)
+	}
+	if err != nil {
+		h.logger().Warn("cache config file", "file", name, "error", err)
+	}
+}
+
+func (h *HTTPFS) isMissing(name string) bool {
+	if missing, ok := h.missing[name]; ok {
+		return missing
+	}
+	if h.CacheDir == "" {
+		return false
+	}
+	_, err := os.Stat(h.cacheFilename(name) + ".missing")
+	return err == nil
+}
+
+func (h *HTTPFS) setFile(name string, f *httpFile) {
+	if h.files == nil {
+		h.files = make(map[string]*httpFile)
+	}
+	h.files[name] = f
+}
+
+// cacheFilename returns the name of the file in the cache directory, which
+// is flat, as names of fetched files may contain slashes.
+func (h *HTTPFS) cacheFilename(name string) string {
+	return filepath.Join(h.CacheDir, url.PathEscape(name))
+}
+
+func (f *httpFile) info(name string) fs.FileInfo {
+	return httpFileInfo{name: name, size: int64(len(f.data)), modTime: f.modTime}
+}
+
+type openHTTPFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (f *openHTTPFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *openHTTPFile) Close() error { return nil }
+
+type httpFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i httpFileInfo) Name() string       { return path.Base(i.name) }
+func (i httpFileInfo) Size() int64        { return i.size }
+func (i httpFileInfo) Mode() fs.FileMode  { return 0o444 }
+func (i httpFileInfo) ModTime() time.Time { return i.modTime }
+func (i httpFileInfo) IsDir() bool        { return false }
+func (i httpFileInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,141 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"resenje.org/x/config"
+)
+
+// configServer serves configuration files from memory with ETags and
+// counts responses by status code.
+type configServer struct {
+	mu       sync.Mutex
+	files    map[string]string
+	statuses map[int]int
+}
+
+func (s *configServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := http.StatusOK
+	defer func() { s.statuses[status]++ }()
+
+	data, ok := s.files[r.URL.Path]
+	if !ok {
+		status = http.StatusNotFound
+		http.NotFound(w, r)
+		return
+	}
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256([]byte(data)))
+	if r.Header.Get("If-None-Match") == etag {
+		status = http.StatusNotModified
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("ETag", etag)
+	io.WriteString(w, data)
+}
+
+func (s *configServer) set(name, data string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.files[name] = data
+}
+
+func (s *configServer) count(status int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.statuses[status]
+}
+
+func TestConfig_HTTP(t *testing.T) {
+	s := &configServer{
+		files:    map[string]string{"/config/http.yaml": "listen: :80\nport: 80\n"},
+		statuses: make(map[int]int),
+	}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	cacheDir := t.TempDir()
+	o := &testOptions{}
+	c := config.New("test")
+	c.Layers = []config.Layer{config.HTTP(ts.URL+"/config", cacheDir)}
+	c.Register("http", o)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if o.Listen != ":80" || o.Port != 80 {
+		t.Fatalf("got %+v", o)
+	}
+	if got := s.count(http.StatusOK); got != 1 {
+		t.Errorf("got %v ok responses, want %v", got, 1)
+	}
+	// one request for every format, without fragment directories
+	if got, want := s.count(http.StatusNotFound), 3; got != want {
+		t.Errorf("got %v not found responses, want %v", got, want)
+	}
+
+	if err := c.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.count(http.StatusOK); got != 1 {
+		t.Errorf("got %v ok responses after reload, want %v", got, 1)
+	}
+	if got := s.count(http.StatusNotModified); got == 0 {
+		t.Error("got no not modified responses after reload")
+	}
+
+	s.set("/config/http.yaml", "listen: :8080\nport: 80\n")
+	if err := c.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if o.Listen != ":8080" {
+		t.Errorf("got listen %q, want %q", o.Listen, ":8080")
+	}
+
+	// the service is not available, use the cache from disk
+	ts.Close()
+	o = &testOptions{}
+	c = config.New("test")
+	c.Layers = []config.Layer{config.FileSystem(&config.HTTPFS{
+		URL:      ts.URL + "/config",
+		CacheDir: cacheDir,
+		Logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})}
+	c.Register("http", o)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if o.Listen != ":8080" || o.Port != 80 {
+		t.Errorf("got cached %+v", o)
+	}
+}
+
+func TestConfig_HTTP_unavailable(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+
+	c := config.New("test")
+	c.Layers = []config.Layer{config.HTTP(ts.URL+"/config", t.TempDir())}
+	c.Register("http", &testOptions{})
+	if err := c.Load(); err == nil || errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v, want network error", err)
+	}
+}
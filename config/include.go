@@ -0,0 +1,176 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// ErrIncludeCycle is returned by Load in FileError if configuration files
+// include each other.
+var ErrIncludeCycle = errors.New("include cycle")
+
+// includeKey is the top level key in configuration files with a glob
+// pattern or a list of glob patterns of files that are loaded before the
+// file, so that values in the file override values from included files.
+// Relative patterns are resolved from the directory of the file. The key is
+// a directive only if options do not have a field with the same key.
+const includeKey = "include"
+
+// loadDocuments reads and parses the configuration file and files that it
+// includes, returning documents in the order in which they are applied.
+// Documents are migrated to the latest version of the named options.
+// Argument stack holds names of files that include this file.
+func (c *Config) loadDocuments(src source, name, filename string, f format, o Options, stack []string) (docs []*document, err error) {
+	if _, ok := f.Format.(dotenvFormat); ok {
+		f.Format = dotenvFormat{prefix: c.envPrefix(name)}
+	}
+	d, err := loadFile(src, filename, f.Format, o)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, nil
+	}
+	d.kind = strings.TrimPrefix(f.ext, ".")
+
+	if c.versioned(name, f, o) {
+		if _, err := c.migrate(name, d); err != nil {
+			return nil, err
+		}
+	}
+
+	patterns, key, err := takeIncludes(d, o)
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range patterns {
+		filenames, err := src.glob(filename, pattern)
+		if err != nil {
+			return nil, &FileError{File: filename, Line: key.Line, Column: key.Column, Err: err}
+		}
+		chain := append(stack[:len(stack):len(stack)], filename)
+		for _, incName := range filenames {
+			if slices.Contains(chain, incName) {
+				err := fmt.Errorf("%w: %s", ErrIncludeCycle, strings.Join(append(chain, incName), " -> "))
+				return nil, &FileError{File: filename, Line: key.Line, Column: key.Column, Err: err}
+			}
+			inc, ok := c.format(incName)
+			if !ok {
+				return nil, &FileError{File: filename, Line: key.Line, Column: key.Column, Err: fmt.Errorf("include %s: unknown format", incName)}
+			}
+			c.included[name] = append(c.included[name], file{src: src, name: incName, format: inc})
+			included, err := c.loadDocuments(src, name, incName, inc, o, chain)
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, included...)
+		}
+	}
+	return append(docs, d), nil
+}
+
+// takeIncludes removes the include directive from the document and returns
+// its patterns and the key node.
+func takeIncludes(d *document, o Options) (patterns []string, key *yaml.Node, err error) {
+	if fieldByKey(optionsFields(o, ""), includeKey, d.json) != nil {
+		return nil, nil, nil
+	}
+	n := resolveNode(d.node)
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil, nil, nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value != includeKey {
+			continue
+		}
+		key = n.Content[i]
+		value := resolveNode(n.Content[i+1])
+		n.Content = append(n.Content[:i:i], n.Content[i+2:]...)
+		switch value.Kind {
+		case yaml.ScalarNode:
+			patterns = []string{value.Value}
+		case yaml.SequenceNode:
+			for _, v := range value.Content {
+				if v.Kind != yaml.ScalarNode {
+					return nil, nil, &FileError{File: d.filename, Line: v.Line, Column: v.Column, Err: errors.New("include pattern must be a string")}
+				}
+				patterns = append(patterns, v.Value)
+			}
+		default:
+			return nil, nil, &FileError{File: d.filename, Line: key.Line, Column: key.Column, Err: errors.New("include must be a pattern or a list of patterns")}
+		}
+		return patterns, key, nil
+	}
+	return nil, nil, nil
+}
+
+// glob returns names of files that match the pattern, relative to the
+// directory of the file with the name, in lexical order. Patterns without
+// meta characters must match an existing file.
+func (s source) glob(name, pattern string) ([]string, error) {
+	var matches []string
+	var err error
+	if s.fsys == nil {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(name), pattern)
+		}
+		matches, err = filepath.Glob(pattern)
+	} else {
+		pattern = path.Join(path.Dir(name), pattern)
+		matches, err = fs.Glob(s.fsys, pattern)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("include %s: %w", pattern, err)
+	}
+	if len(matches) == 0 && !strings.ContainsAny(pattern, `*?[\`) {
+		return nil, fmt.Errorf("include %s: %w", pattern, fs.ErrNotExist)
+	}
+	return matches, nil
+}
+
+// fragments returns configuration files in the <name>.d directory of the
+// source in lexical order. Files with unknown extensions are skipped.
+// HTTPFS can not list files, so it is not asked for the directory.
+func (c *Config) fragments(src source, name string) (files []file) {
+	if _, ok := src.fsys.(*HTTPFS); ok {
+		return nil
+	}
+	dir := src.path(name + ".d")
+	entries, err := src.readDir(dir)
+	if err != nil {
+		return nil
+	}
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		f, ok := c.format(e.Name())
+		if !ok {
+			continue
+		}
+		files = append(files, file{src: src, name: src.join(dir, e.Name()), format: f})
+	}
+	return files
+}
+
+// format returns the format of the file by its extension.
+func (c *Config) format(filename string) (format, bool) {
+	for _, f := range c.formats() {
+		if strings.HasSuffix(filename, f.ext) {
+			return f, true
+		}
+	}
+	return format{}, false
+}
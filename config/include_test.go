@@ -0,0 +1,116 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"resenje.org/x/config"
+)
+
+func TestConfig_fragments(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "http.yaml"), "listen: :80\nport: 80\n")
+	if err := os.Mkdir(filepath.Join(dir, "http.d"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "http.d", "20-port.yaml"), "port: 8080\n")
+	writeFile(t, filepath.Join(dir, "http.d", "10-port.json"), `{"port": 8000, "domains": ["a.com"]}`)
+	writeFile(t, filepath.Join(dir, "http.d", "30-port.yaml.rpmsave"), "port: 1\n")
+	writeFile(t, filepath.Join(dir, "http.d", ".hidden.yaml"), "port: 2\n")
+
+	o := &testOptions{}
+	c := config.New("test", dir)
+	c.Register("http", o)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	want := &testOptions{Listen: ":80", Port: 8080, Domains: []string{"a.com"}}
+	if !reflect.DeepEqual(o, want) {
+		t.Errorf("got %+v, want %+v", o, want)
+	}
+	if got, want := c.Origin("http", "port").String(), filepath.Join(dir, "http.d", "20-port.yaml")+":1:1"; got != want {
+		t.Errorf("got port origin %q, want %q", got, want)
+	}
+}
+
+func TestConfig_include(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "http.yaml"), "include:\n- common/*.yaml\n- /dev/null/missing*\nport: 80\n")
+	if err := os.Mkdir(filepath.Join(dir, "common"), 0o777); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "common", "a.yaml"), "listen: :1\nport: 1\n")
+	writeFile(t, filepath.Join(dir, "common", "b.yaml"), "include: ../domains.json\nlisten: :2\n")
+	writeFile(t, filepath.Join(dir, "domains.json"), `{"domains": ["a.com"]}`)
+
+	o := &testOptions{}
+	c := config.New("test", dir)
+	c.UnknownKeys = config.Fail
+	c.Register("http", o)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	want := &testOptions{Listen: ":2", Port: 80, Domains: []string{"a.com"}}
+	if !reflect.DeepEqual(o, want) {
+		t.Errorf("got %+v, want %+v", o, want)
+	}
+}
+
+func TestConfig_include_fs(t *testing.T) {
+	o := &testOptions{}
+	c := config.New("test")
+	c.FS = []fs.FS{fstest.MapFS{
+		"http.yaml":        {Data: []byte("include: conf/listen.yaml\nport: 80\n")},
+		"conf/listen.yaml": {Data: []byte("listen: :80\n")},
+	}}
+	c.Register("http", o)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if o.Listen != ":80" || o.Port != 80 {
+		t.Errorf("got %+v", o)
+	}
+}
+
+func TestConfig_include_errors(t *testing.T) {
+	t.Run("cycle", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "http.yaml"), "include: a.yaml\n")
+		writeFile(t, filepath.Join(dir, "a.yaml"), "include: b.yaml\n")
+		writeFile(t, filepath.Join(dir, "b.yaml"), "port: 1\ninclude: a.yaml\n")
+
+		c := config.New("test", dir)
+		c.Register("http", &testOptions{})
+		err := c.Load()
+		if !errors.Is(err, config.ErrIncludeCycle) {
+			t.Fatalf("got error %v, want %v", err, config.ErrIncludeCycle)
+		}
+		name := func(s string) string { return filepath.Join(dir, s) }
+		want := `load yaml "http" config: ` + name("b.yaml") + ":2:1: include cycle: " +
+			name("http.yaml") + " -> " + name("a.yaml") + " -> " + name("b.yaml") + " -> " + name("a.yaml")
+		if err.Error() != want {
+			t.Errorf("got error %q, want %q", err, want)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "http.yaml"), "include: missing.yaml\n")
+
+		c := config.New("test", dir)
+		c.Register("http", &testOptions{})
+		if err := c.Load(); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("got error %v, want %v", err, os.ErrNotExist)
+		}
+	})
+}
@@ -0,0 +1,276 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Interpolation errors that are returned by Load in FileError.
+var (
+	ErrRequiredVariable = errors.New("required variable")
+	ErrUnknownReference = errors.New("unknown reference")
+	ErrReferenceCycle   = errors.New("reference cycle")
+)
+
+// interpolate replaces expressions in string values of documents of all
+// registered options. Expressions have the form:
+//
+//	${NAME}            value of the environment variable NAME
+//	${NAME:-default}   default if NAME is not set or empty
+//	${NAME:?message}   error with the message if NAME is not set or empty
+//	${http.listen}     value of the key listen of options named http
+//	$${NAME}           literal ${NAME}
+//
+// References to other options values are resolved to the values from the
+// last configuration file that sets them or, if no file sets them, to the
+// current options values. Defaults may contain expressions.
+func (c *Config) interpolate(values []Options, docs [][]*document) error {
+	ip := &interpolator{
+		c:         c,
+		values:    values,
+		docs:      docs,
+		done:      make(map[*yaml.Node]struct{}),
+		resolving: make(map[*yaml.Node]struct{}),
+	}
+	for i, o := range c.options {
+		for _, d := range docs[i] {
+			if err := ip.node(d, d.node); err != nil {
+				return fmt.Errorf("load %s %q config: %w", d.kind, o.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+type interpolator struct {
+	c      *Config
+	values []Options
+	docs   [][]*document
+	// nodes that are interpolated
+	done map[*yaml.Node]struct{}
+	// nodes that are being interpolated, for cycle detection
+	resolving map[*yaml.Node]struct{}
+	// references that are being resolved, for error messages
+	stack []string
+}
+
+// node interpolates all values in the node tree.
+func (ip *interpolator) node(d *document, n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, c := range n.Content {
+			if err := ip.node(d, c); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			if err := ip.node(d, n.Content[i]); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		return ip.scalar(d, n)
+	}
+	return nil
+}
+
+// scalar interpolates the value of the scalar node. If the whole value is a
+// single expression in a plain yaml scalar or a json string, the type of
+// the result is resolved as if it was written in the file, so that numbers
+// and booleans can be interpolated.
+func (ip *interpolator) scalar(d *document, n *yaml.Node) error {
+	if _, ok := ip.done[n]; ok {
+		return nil
+	}
+	if !strings.Contains(n.Value, "$") {
+		ip.done[n] = struct{}{}
+		return nil
+	}
+	if _, ok := ip.resolving[n]; ok {
+		return fmt.Errorf("%w: %s", ErrReferenceCycle, strings.Join(ip.stack, " -> "))
+	}
+	ip.resolving[n] = struct{}{}
+	v, err := ip.expand(d, n, n.Value)
+	delete(ip.resolving, n)
+	if err != nil {
+		return err
+	}
+	ip.done[n] = struct{}{}
+
+	single := isSingleExpression(n.Value)
+	n.Value = v
+	if single && (d.json || n.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0) {
+		n.Tag = (&yaml.Node{Kind: yaml.ScalarNode, Value: v}).ShortTag()
+	}
+	return nil
+}
+
+// expand replaces all expressions in the string s.
+func (ip *interpolator) expand(d *document, n *yaml.Node, s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if strings.HasPrefix(s[i:], "$${") {
+			b.WriteString("${")
+			i += 3
+			continue
+		}
+		if !strings.HasPrefix(s[i:], "${") {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+		end := expressionEnd(s, i)
+		if end < 0 {
+			return "", ip.error(d, n, fmt.Errorf("unterminated expression %q", s[i:]))
+		}
+		v, err := ip.eval(d, n, s[i+2:end])
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(v)
+		i = end + 1
+	}
+	return b.String(), nil
+}
+
+// eval returns the value of a single expression without ${ and }.
+func (ip *interpolator) eval(d *document, n *yaml.Node, expr string) (string, error) {
+	name, op, arg := expr, "", ""
+	if i := strings.Index(expr, ":"); i >= 0 && i+1 < len(expr) && (expr[i+1] == '-' || expr[i+1] == '?') {
+		name, op, arg = expr[:i], expr[i:i+2], expr[i+2:]
+	}
+	name = strings.TrimSpace(name)
+
+	var value string
+	var found bool
+	if strings.Contains(name, ".") {
+		v, ok, err := ip.reference(d, n, name)
+		if err != nil {
+			return "", err
+		}
+		value, found = v, ok
+	} else {
+		value, found = os.LookupEnv(name)
+	}
+	if found && value != "" {
+		return value, nil
+	}
+
+	switch op {
+	case ":-":
+		return ip.expand(d, n, arg)
+	case ":?":
+		msg, err := ip.expand(d, n, arg)
+		if err != nil {
+			return "", err
+		}
+		if msg == "" {
+			msg = "not set"
+		}
+		return "", ip.error(d, n, fmt.Errorf("%w %s: %s", ErrRequiredVariable, name, msg))
+	}
+	if !found && strings.Contains(name, ".") {
+		return "", ip.error(d, n, fmt.Errorf("%w %s", ErrUnknownReference, name))
+	}
+	return value, nil
+}
+
+// reference returns the value of the key of other options, in the form of
+// options name and the dot separated path of keys.
+func (ip *interpolator) reference(d *document, n *yaml.Node, ref string) (value string, found bool, err error) {
+	name, key, _ := strings.Cut(ref, ".")
+	for i, o := range ip.c.options {
+		if o.name != name {
+			continue
+		}
+		fields := optionsFields(ip.values[i], "")
+		for j := len(ip.docs[i]) - 1; j >= 0; j-- {
+			rd := ip.docs[i][j]
+			rn := lookupNode(rd.node, fields, key, rd.json)
+			if rn == nil {
+				continue
+			}
+			if rn.Kind != yaml.ScalarNode {
+				return "", false, ip.error(d, n, fmt.Errorf("reference %s is not a scalar value", ref))
+			}
+			ip.stack = append(ip.stack, ref)
+			err := ip.scalar(rd, rn)
+			ip.stack = ip.stack[:len(ip.stack)-1]
+			if err != nil {
+				var fe *FileError
+				if !errors.As(err, &fe) {
+					err = ip.error(d, n, err)
+				}
+				return "", false, err
+			}
+			return rn.Value, true, nil
+		}
+		var current yaml.Node
+		if err := current.Encode(ip.values[i]); err != nil {
+			return "", false, ip.error(d, n, err)
+		}
+		rn := lookupNode(&current, fields, key, false)
+		if rn == nil {
+			return "", false, nil
+		}
+		if rn.Kind != yaml.ScalarNode {
+			return "", false, ip.error(d, n, fmt.Errorf("reference %s is not a scalar value", ref))
+		}
+		return rn.Value, true, nil
+	}
+	return "", false, nil
+}
+
+func (ip *interpolator) error(d *document, n *yaml.Node, err error) error {
+	return &FileError{
+		File:   d.filename,
+		Line:   n.Line,
+		Column: n.Column,
+		Err:    err,
+	}
+}
+
+// lookupNode returns the value node under the dot separated path of yaml
+// keys.
+func lookupNode(n *yaml.Node, fields []*field, path string, json bool) (value *yaml.Node) {
+	walkMapping(n, fields, json, func(f *field, _, v *yaml.Node) {
+		if f != nil && f.path == path {
+			value = v
+		}
+	})
+	return value
+}
+
+// expressionEnd returns the index of the closing brace of the expression
+// that starts at index i, taking nested expressions into account.
+func expressionEnd(s string, i int) int {
+	depth := 0
+	for j := i; j < len(s); j++ {
+		switch {
+		case strings.HasPrefix(s[j:], "${"):
+			depth++
+			j++
+		case s[j] == '}':
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// isSingleExpression returns true if the whole string s is one expression.
+func isSingleExpression(s string) bool {
+	return strings.HasPrefix(s, "${") && expressionEnd(s, 0) == len(s)-1
+}
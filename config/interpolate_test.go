@@ -0,0 +1,99 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"resenje.org/x/config"
+)
+
+func TestConfig_Load_interpolate(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(dir, "http.yaml"), "listen: ${LISTEN_HOST:-localhost}:${LISTEN_PORT}\nport: ${LISTEN_PORT}\ndomains:\n  - ${api.listen}\n  - $${escaped}\n")
+	writeFile(t, filepath.Join(dir, "api.json"), `{"listen": "api.${DOMAIN:?domain is required}", "port": "${http.port}"}`)
+	t.Setenv("LISTEN_PORT", "8080")
+	t.Setenv("DOMAIN", "example.com")
+
+	httpOptions := &testOptions{}
+	apiOptions := &testOptions{}
+	c := config.New("test", dir)
+	c.Interpolate = true
+	c.Register("http", httpOptions)
+	c.Register("api", apiOptions)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &testOptions{
+		Listen:  "localhost:8080",
+		Port:    8080,
+		Domains: []string{"api.example.com", "${escaped}"},
+	}
+	if !reflect.DeepEqual(httpOptions, want) {
+		t.Errorf("got http options %+v, want %+v", httpOptions, want)
+	}
+	want = &testOptions{
+		Listen: "api.example.com",
+		Port:   8080,
+	}
+	if !reflect.DeepEqual(apiOptions, want) {
+		t.Errorf("got api options %+v, want %+v", apiOptions, want)
+	}
+}
+
+func TestConfig_Load_interpolateErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data string
+		want error
+		line int
+	}{
+		{
+			name: "required",
+			data: "listen: ${MISSING_HOST:?host is required}\n",
+			want: config.ErrRequiredVariable,
+			line: 1,
+		},
+		{
+			name: "cycle",
+			data: "listen: ${http.domains}\ndomains: ${http.listen}\n",
+			want: config.ErrReferenceCycle,
+			line: 2,
+		},
+		{
+			name: "unknown reference",
+			data: "listen: ${smtp.host}\n",
+			want: config.ErrUnknownReference,
+			line: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, filepath.Join(dir, "http.yaml"), tc.data)
+
+			c := config.New("test", dir)
+			c.Interpolate = true
+			c.Register("http", &testOptions{})
+
+			err := c.Load()
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("got error %v, want %v", err, tc.want)
+			}
+			var fe *config.FileError
+			if !errors.As(err, &fe) {
+				t.Fatalf("got error %T, want %T", err, fe)
+			}
+			if fe.Line != tc.line {
+				t.Errorf("got line %v, want %v", fe.Line, tc.line)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"io/fs"
+
+	"github.com/kelseyhightower/envconfig"
+)
+
+// Layer is a source of configuration values. Layers are applied to options
+// in the order of Config Layers, so that values from every layer override
+// values from previous ones and values that options had when they were
+// registered.
+type Layer interface {
+	// files returns configuration files of the named options that the
+	// layer reads, if the layer is file based.
+	files(c *Config, name string) []file
+	// apply sets values from sources other than files to o and records
+	// their origins.
+	apply(c *Config, name string, o Options, fields []*field, origins map[string]Origin) error
+}
+
+// Layers that are provided by the package.
+var (
+	// Env sets values from environment variables as envconfig does, with
+	// the prefix returned by Config Name and options name. Values are also
+	// read from files which names are in environment variables with the
+	// _FILE suffix, like TEST_SMTP_PASSWORD_FILE, if the variable without
+	// the suffix is not set.
+	Env Layer = envLayer{}
+	// Flags sets values from command line flags bound with BindFlags.
+	Flags Layer = flagsLayer{}
+)
+
+// Dir returns a layer that reads configuration files from a directory.
+func Dir(dir string) Layer {
+	return fileLayer{src: source{dir: dir}}
+}
+
+// FileSystem returns a layer that reads configuration files from the root
+// directory of the file system.
+func FileSystem(fsys fs.FS) Layer {
+	return fileLayer{src: source{fsys: fsys, dir: "."}}
+}
+
+// Only returns a layer that applies the layer l only to options with
+// provided names.
+func Only(l Layer, names ...string) Layer {
+	return filterLayer{Layer: l, names: names, only: true}
+}
+
+// Except returns a layer that applies the layer l to all options except
+// the ones with provided names.
+func Except(l Layer, names ...string) Layer {
+	return filterLayer{Layer: l, names: names}
+}
+
+// layers returns Layers or, if they are not set, the default layers: file
+// systems in FS, directories in Dirs, environment variables and flags.
+func (c *Config) layers() []Layer {
+	if c.Layers != nil {
+		return c.Layers
+	}
+	layers := make([]Layer, 0, len(c.FS)+len(c.Dirs)+2)
+	for _, fsys := range c.FS {
+		layers = append(layers, FileSystem(fsys))
+	}
+	for _, dir := range c.Dirs {
+		layers = append(layers, Dir(dir))
+	}
+	return append(layers, Env, Flags)
+}
+
+type fileLayer struct {
+	src source
+}
+
+func (l fileLayer) files(c *Config, name string) []file {
+	return c.sourceFiles(l.src, name)
+}
+
+func (fileLayer) apply(*Config, string, Options, []*field, map[string]Origin) error {
+	return nil
+}
+
+type envLayer struct{}
+
+func (envLayer) files(*Config, string) []file {
+	return nil
+}
+
+func (envLayer) apply(c *Config, name string, o Options, fields []*field, origins map[string]Origin) error {
+	if err := envconfig.Process(c.envPrefix(name), o); err != nil {
+		return fmt.Errorf("load %q env variables: %v", name, err)
+	}
+	recordEnvOrigins(origins, fields)
+	if err := applyEnvFiles(name, o, fields, origins); err != nil {
+		return err
+	}
+	return c.applyEnvAliases(name, o, fields, origins)
+}
+
+type flagsLayer struct{}
+
+func (flagsLayer) files(*Config, string) []file {
+	return nil
+}
+
+func (flagsLayer) apply(c *Config, name string, o Options, _ []*field, origins map[string]Origin) error {
+	return c.applyFlags(name, o, origins)
+}
+
+type filterLayer struct {
+	Layer
+	names []string
+	only  bool
+}
+
+func (l filterLayer) applies(name string) bool {
+	for _, n := range l.names {
+		if n == name {
+			return l.only
+		}
+	}
+	return !l.only
+}
+
+func (l filterLayer) files(c *Config, name string) []file {
+	if !l.applies(name) {
+		return nil
+	}
+	return l.Layer.files(c, name)
+}
+
+func (l filterLayer) apply(c *Config, name string, o Options, fields []*field, origins map[string]Origin) error {
+	if !l.applies(name) {
+		return nil
+	}
+	return l.Layer.apply(c, name, o, fields, origins)
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"resenje.org/x/config"
+)
+
+func TestConfig_Layers(t *testing.T) {
+	etc, home := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(etc, "http.yaml"), "listen: :80\nport: 80\n")
+	writeFile(t, filepath.Join(home, "http.yaml"), "port: 8080\n")
+	writeFile(t, filepath.Join(home, "api.yaml"), "port: 8081\n")
+	embedded := fstest.MapFS{
+		"http.yaml": {Data: []byte("listen: :1\nport: 1\ndomains: [embedded.com]\n")},
+	}
+	t.Setenv("TEST_HTTP_PORT", "9090")
+	t.Setenv("TEST_HTTP_DOMAINS", "env.com")
+	t.Setenv("TEST_API_PORT", "9091")
+
+	httpOptions := &testOptions{}
+	apiOptions := &testOptions{}
+	c := config.New("test", "ignored")
+	c.Layers = []config.Layer{
+		config.FileSystem(embedded),
+		config.Dir(etc),
+		config.Except(config.Env, "api"),
+		config.Only(config.Dir(home), "api"),
+	}
+	c.Register("http", httpOptions)
+	c.Register("api", apiOptions)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if httpOptions.Listen != ":80" {
+		t.Errorf("got http listen %q, want %q", httpOptions.Listen, ":80")
+	}
+	if httpOptions.Port != 9090 {
+		t.Errorf("got http port %v, want %v", httpOptions.Port, 9090)
+	}
+	if len(httpOptions.Domains) != 1 || httpOptions.Domains[0] != "env.com" {
+		t.Errorf("got http domains %v, want %v", httpOptions.Domains, []string{"env.com"})
+	}
+	if apiOptions.Port != 8081 {
+		t.Errorf("got api port %v, want %v", apiOptions.Port, 8081)
+	}
+	if got, want := c.Origin("http", "listen").String(), filepath.Join(etc, "http.yaml")+":1:1"; got != want {
+		t.Errorf("got http listen origin %q, want %q", got, want)
+	}
+}
+
+func TestConfig_Layers_noEnv(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "http.yaml"), "port: 80\n")
+	t.Setenv("TEST_HTTP_PORT", "9090")
+
+	o := &testOptions{}
+	c := config.New("test")
+	c.Layers = []config.Layer{config.Dir(dir)}
+	c.Register("http", o)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if o.Port != 80 {
+		t.Errorf("got port %v, want %v", o.Port, 80)
+	}
+}
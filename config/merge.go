@@ -0,0 +1,239 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Merge strategies that are set with the merge struct tag on slice and map
+// fields, for example merge:"append" or merge:"key=name". They define how
+// a value from a configuration file, environment variables or flags is
+// combined with the value from previous sources.
+const (
+	// MergeReplace replaces the previous value. It is the default for
+	// slices.
+	MergeReplace = "replace"
+	// MergeAppend appends elements to the previous slice. Every load
+	// starts appending from the value that the slice had at registration.
+	MergeAppend = "append"
+	// MergeMap sets keys in the previous map, keeping the other keys. It is
+	// the default for maps.
+	MergeMap = "merge"
+	// MergeKey replaces elements of a slice of structs that have the same
+	// value of the field with the yaml key after the equal sign, like
+	// key=name, and appends other elements.
+	MergeKey = "key"
+)
+
+// merger combines values of a slice or a map field that are set by
+// multiple sources.
+type merger struct {
+	f        *field
+	strategy string
+	// index of the struct field that identifies elements for MergeKey
+	keyIndex []int
+}
+
+// mergers returns mergers for all slice and map fields.
+func mergers(fields []*field) (ms []merger, err error) {
+	for _, f := range leafFields(fields) {
+		t := f.typ
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Map {
+			if _, ok := f.tag.Lookup("merge"); ok {
+				return nil, fmt.Errorf("%s: merge strategy is supported only for slices and maps", f.path)
+			}
+			continue
+		}
+		m := merger{f: f, strategy: MergeReplace}
+		if t.Kind() == reflect.Map {
+			m.strategy = MergeMap
+		}
+		tag, ok := f.tag.Lookup("merge")
+		if !ok {
+			if m.strategy == MergeReplace {
+				// replacing is what decoding does
+				continue
+			}
+			tag = m.strategy
+		}
+		strategy, key, _ := strings.Cut(tag, "=")
+		switch {
+		case strategy == MergeReplace:
+		case strategy == MergeMap && t.Kind() == reflect.Map:
+		case strategy == MergeAppend && t.Kind() == reflect.Slice:
+		case strategy == MergeKey && t.Kind() == reflect.Slice:
+			st := structType(t.Elem())
+			if st == nil {
+				return nil, fmt.Errorf("%s: merge strategy %q requires a slice of structs", f.path, tag)
+			}
+			for _, ef := range structFields(st, nil, "", "") {
+				if ef.key == key && ef.leaf() {
+					m.keyIndex = ef.index
+				}
+			}
+			if m.keyIndex == nil {
+				return nil, fmt.Errorf("%s: unknown merge key %q", f.path, key)
+			}
+		default:
+			return nil, fmt.Errorf("%s: invalid merge strategy %q for %s", f.path, tag, f.typ)
+		}
+		m.strategy = strategy
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+// resetAppended sets slice fields with MergeAppend strategy of options o to
+// their values at registration, so that values from sources are not
+// appended again when options are loaded repeatedly.
+func (c *Config) resetAppended(name string, o Options, ms []merger) {
+	root := reflect.Indirect(reflect.ValueOf(o))
+	if root.Kind() != reflect.Struct {
+		return
+	}
+	var defaults reflect.Value
+	for _, opts := range c.options {
+		if opts.name == name {
+			defaults = reflect.Indirect(reflect.ValueOf(opts.defaults))
+		}
+	}
+	for _, m := range ms {
+		if m.strategy != MergeAppend {
+			continue
+		}
+		v, err := root.FieldByIndexErr(m.f.index)
+		if err != nil {
+			// nil pointer to a parent struct
+			continue
+		}
+		d := reflect.Zero(v.Type())
+		if defaults.IsValid() {
+			if dv, err := defaults.FieldByIndexErr(m.f.index); err == nil {
+				d = deepCopy(dv)
+			}
+		}
+		v.Set(d)
+	}
+}
+
+// merge calls fn that sets values from a single source to options o and
+// records their origins, so that slice and map fields that fn sets are
+// combined with their previous values.
+func merge(o Options, ms []merger, origins map[string]Origin, fn func() error) error {
+	root := reflect.Indirect(reflect.ValueOf(o))
+	if len(ms) == 0 || root.Kind() != reflect.Struct {
+		return fn()
+	}
+	prev := make([]reflect.Value, len(ms))
+	before := make([]Origin, len(ms))
+	for i, m := range ms {
+		before[i] = origins[m.f.path]
+		v, err := root.FieldByIndexErr(m.f.index)
+		if err != nil {
+			// nil pointer to a parent struct
+			continue
+		}
+		prev[i] = reflect.New(v.Type()).Elem()
+		prev[i].Set(v)
+		// the source sets only its own values
+		v.Set(reflect.Zero(v.Type()))
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	for i, m := range ms {
+		if !prev[i].IsValid() {
+			continue
+		}
+		v := root.FieldByIndex(m.f.index)
+		if origins[m.f.path] == before[i] {
+			// not set by the source
+			v.Set(prev[i])
+			continue
+		}
+		v.Set(m.combine(prev[i], v))
+	}
+	return nil
+}
+
+// combine returns the value of the field that is set to cur after it had
+// the value prev.
+func (m merger) combine(prev, cur reflect.Value) reflect.Value {
+	t := cur.Type()
+	p, c := reflect.Indirect(prev), reflect.Indirect(cur)
+	if !p.IsValid() || !c.IsValid() || m.strategy == MergeReplace {
+		return cur
+	}
+	var r reflect.Value
+	switch m.strategy {
+	case MergeMap:
+		if p.IsNil() {
+			return cur
+		}
+		r = reflect.MakeMapWithSize(c.Type(), p.Len()+c.Len())
+		for _, src := range []reflect.Value{p, c} {
+			iter := src.MapRange()
+			for iter.Next() {
+				r.SetMapIndex(iter.Key(), iter.Value())
+			}
+		}
+	case MergeAppend:
+		r = reflect.AppendSlice(reflect.MakeSlice(c.Type(), 0, p.Len()+c.Len()), p)
+		r = reflect.AppendSlice(r, c)
+	case MergeKey:
+		r = reflect.AppendSlice(reflect.MakeSlice(c.Type(), 0, p.Len()+c.Len()), p)
+		for i := 0; i < c.Len(); i++ {
+			e := c.Index(i)
+			j := m.find(r, m.key(e))
+			if j < 0 {
+				r = reflect.Append(r, e)
+				continue
+			}
+			r.Index(j).Set(e)
+		}
+	default:
+		return cur
+	}
+	if t.Kind() == reflect.Ptr {
+		ptr := reflect.New(t.Elem())
+		ptr.Elem().Set(r)
+		return ptr
+	}
+	return r
+}
+
+// key returns the value of the key field of the slice element or an
+// invalid value if the element is a nil pointer.
+func (m merger) key(e reflect.Value) reflect.Value {
+	e = reflect.Indirect(e)
+	if !e.IsValid() {
+		return e
+	}
+	v, err := e.FieldByIndexErr(m.keyIndex)
+	if err != nil {
+		return reflect.Value{}
+	}
+	return v
+}
+
+// find returns the index of the element in the slice s with the key, or -1.
+func (m merger) find(s, key reflect.Value) int {
+	if !key.IsValid() {
+		return -1
+	}
+	for i := 0; i < s.Len(); i++ {
+		if k := m.key(s.Index(i)); k.IsValid() && reflect.DeepEqual(k.Interface(), key.Interface()) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"resenje.org/x/config"
+)
+
+type backend struct {
+	Name    string `yaml:"name"`
+	Address string `yaml:"address"`
+}
+
+type mergeOptions struct {
+	Domains  []string          `yaml:"domains"`
+	Notify   []string          `yaml:"notify" merge:"append"`
+	Labels   map[string]string `yaml:"labels"`
+	Headers  map[string]string `yaml:"headers" merge:"replace"`
+	Backends []backend         `yaml:"backends" merge:"key=name"`
+}
+
+func (o *mergeOptions) VerifyAndPrepare() error { return nil }
+
+func TestConfig_merge(t *testing.T) {
+	etc, home := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(etc, "app.yaml"), `
+domains: [a.com]
+notify: [ops@a.com]
+labels: {team: core, env: dev}
+headers: {X-A: a, X-B: b}
+backends:
+- {name: api, address: ":1"}
+- {name: web, address: ":2"}
+`)
+	writeFile(t, filepath.Join(home, "app.json"), `{
+"domains": ["b.com"],
+"notify": ["dev@a.com"],
+"labels": {"env": "prod"},
+"headers": {"X-C": "c"},
+"backends": [{"name": "web", "address": ":20"}, {"name": "admin", "address": ":3"}]
+}`)
+	t.Setenv("TEST_APP_NOTIFY", "env@a.com")
+	t.Setenv("TEST_APP_LABELS", "region:eu")
+
+	o := &mergeOptions{Notify: []string{"root@a.com"}}
+	c := config.New("test", etc, home)
+	c.Register("app", o)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	want := &mergeOptions{
+		Domains: []string{"b.com"},
+		Notify:  []string{"root@a.com", "ops@a.com", "dev@a.com", "env@a.com"},
+		Labels:  map[string]string{"team": "core", "env": "prod", "region": "eu"},
+		Headers: map[string]string{"X-C": "c"},
+		Backends: []backend{
+			{Name: "api", Address: ":1"},
+			{Name: "web", Address: ":20"},
+			{Name: "admin", Address: ":3"},
+		},
+	}
+	if !reflect.DeepEqual(o, want) {
+		t.Errorf("got %+v, want %+v", o, want)
+	}
+
+	// load and reload start from registered values
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(o, want) {
+		t.Errorf("got %+v after second load, want %+v", o, want)
+	}
+	if err := c.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(o, want) {
+		t.Errorf("got %+v after reload, want %+v", o, want)
+	}
+}
+
+func TestConfig_Load_keepsValues(t *testing.T) {
+	o := &mergeOptions{}
+	c := config.New("test", t.TempDir())
+	c.Register("app", o)
+	// values set after registration are kept by Load, as before merge
+	// strategies
+	o.Domains = []string{"a.com"}
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.com"}; !reflect.DeepEqual(o.Domains, want) {
+		t.Errorf("got domains %v, want %v", o.Domains, want)
+	}
+}
+
+func TestConfig_merge_invalid(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		o    config.Options
+		err  string
+	}{
+		{
+			name: "append map",
+			o: &struct {
+				mergeOptions
+				Invalid map[string]string `yaml:"invalid" merge:"append"`
+			}{},
+			err: `invalid merge strategy "append"`,
+		},
+		{
+			name: "unknown key",
+			o: &struct {
+				mergeOptions
+				Invalid []backend `yaml:"invalid" merge:"key=id"`
+			}{},
+			err: `unknown merge key "id"`,
+		},
+		{
+			name: "scalar",
+			o: &struct {
+				mergeOptions
+				Invalid string `yaml:"invalid" merge:"append"`
+			}{},
+			err: "merge strategy is supported only for slices and maps",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := config.New("test")
+			c.Register("app", tc.o)
+			err := c.Load()
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("got error %v, want %q", err, tc.err)
+			}
+		})
+	}
+}
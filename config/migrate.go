@@ -0,0 +1,291 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// ErrUnsupportedVersion is returned by Load in FileError if the version of
+// a configuration file is not known to registered migrations.
+var ErrUnsupportedVersion = errors.New("unsupported version")
+
+// versionKey is the top level key in configuration files with the integer
+// version of their structure. Files without it are at version 1. The key is
+// a directive only if migrations are registered for options and options do
+// not have a field with the same key.
+const versionKey = "version"
+
+// Migration changes the structure of a configuration file document to the
+// next version. The node is the top level mapping of the document, with
+// keys as they are written in the file, without the version key. Keys in
+// json files are json keys.
+type Migration func(n *yaml.Node) error
+
+// RegisterMigration registers the migration of configuration files of the
+// named options from version-1 to the version. The highest registered
+// version is the latest one and Load runs migrations in order on every file
+// with an older version before its values are decoded, so that options have
+// only fields of the latest version. Migrations must be registered for all
+// versions from 2 to the latest one. Dotenv files are never migrated, as
+// names of their variables are derived from current options fields.
+func (c *Config) RegisterMigration(name string, version int, m Migration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.migrations == nil {
+		c.migrations = make(map[string]map[int]Migration)
+	}
+	if c.migrations[name] == nil {
+		c.migrations[name] = make(map[int]Migration)
+	}
+	c.migrations[name][version] = m
+}
+
+// latestVersion returns the latest version of configuration files of the
+// named options, or 0 if there are no migrations registered for them.
+func (c *Config) latestVersion(name string) (latest int) {
+	for v := range c.migrations[name] {
+		if v > latest {
+			latest = v
+		}
+	}
+	return latest
+}
+
+// versioned returns true if the version key in the document is a directive.
+func (c *Config) versioned(name string, f format, o Options) bool {
+	if c.latestVersion(name) == 0 {
+		return false
+	}
+	if _, ok := f.Format.(dotenvFormat); ok {
+		return false
+	}
+	_, isJSON := f.Format.(jsonFormat)
+	return fieldByKey(optionsFields(o, ""), versionKey, isJSON) == nil
+}
+
+// migrate removes the version key from the document and runs migrations
+// from its version to the latest one. It returns the version of the
+// document before migrations.
+func (c *Config) migrate(name string, d *document) (version int, err error) {
+	n := resolveNode(d.node)
+	if n == nil || n.Kind != yaml.MappingNode {
+		return 0, nil
+	}
+	version = 1
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value != versionKey {
+			continue
+		}
+		value := resolveNode(n.Content[i+1])
+		v, err := strconv.Atoi(value.Value)
+		if value.Kind != yaml.ScalarNode || err != nil || v < 1 {
+			return 0, &FileError{File: d.filename, Line: value.Line, Column: value.Column, Err: errors.New("version must be a positive integer")}
+		}
+		version = v
+		n.Content = append(n.Content[:i:i], n.Content[i+2:]...)
+		break
+	}
+	latest := c.latestVersion(name)
+	if version > latest {
+		return 0, &FileError{File: d.filename, Err: fmt.Errorf("%w %d, latest version is %d", ErrUnsupportedVersion, version, latest)}
+	}
+	for v := version + 1; v <= latest; v++ {
+		m, ok := c.migrations[name][v]
+		if !ok {
+			return 0, fmt.Errorf("migrate %s: no migration to version %d", d.filename, v)
+		}
+		if err := m(n); err != nil {
+			return 0, fmt.Errorf("migrate %s to version %d: %w", d.filename, v, err)
+		}
+	}
+	return version, nil
+}
+
+// MigratedFile is a configuration file that is rewritten by MigrateFiles.
+type MigratedFile struct {
+	// File is the name of the rewritten file.
+	File string
+	// Backup is the name of the file with the original content.
+	Backup string
+	// From and To are versions of the file before and after migrations.
+	From, To int
+}
+
+func (f MigratedFile) String() string {
+	return fmt.Sprintf("%s: version %d -> %d (backup %s)", f.File, f.From, f.To, f.Backup)
+}
+
+// MigrateFiles rewrites configuration files of registered options with
+// versions older than the latest one in place, running their migrations
+// and setting the latest version. The original content of every rewritten
+// file is kept in a file with the version appended to its name, like
+// http.yaml.v1.bak. Only yaml, json and toml files in directories on the
+// operating system are rewritten. Comments are preserved only in yaml
+// files, and keys of json and toml files are sorted. Files that are
+// included by other files are not rewritten, but they are still migrated by
+// Load.
+func (c *Config) MigrateFiles() (migrated []MigratedFile, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, o := range c.options {
+		for _, f := range c.files(o.name) {
+			if f.src.fsys != nil || !c.versioned(o.name, f.format, o.o) {
+				continue
+			}
+			m, err := c.migrateFile(o.name, f, o.o)
+			if err != nil {
+				return migrated, err
+			}
+			if m != nil {
+				migrated = append(migrated, *m)
+			}
+		}
+	}
+	return migrated, nil
+}
+
+// migrateFile rewrites the file if its version is older than the latest
+// one. It returns nil if the file is not rewritten.
+func (c *Config) migrateFile(name string, f file, o Options) (*MigratedFile, error) {
+	info, err := os.Stat(f.name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var encode func(*yaml.Node) ([]byte, error)
+	switch f.format.Format.(type) {
+	case yamlFormat:
+		encode = encodeYAML
+	case jsonFormat:
+		encode = encodeJSON
+	case tomlFormat:
+		encode = encodeTOML
+	default:
+		return nil, nil
+	}
+	data, err := os.ReadFile(f.name)
+	if err != nil {
+		return nil, err
+	}
+	d, err := loadFile(f.src, f.name, f.format.Format, o)
+	if err != nil || d == nil {
+		return nil, err
+	}
+	version, err := c.migrate(name, d)
+	if err != nil {
+		return nil, err
+	}
+	latest := c.latestVersion(name)
+	if version == 0 || version == latest {
+		return nil, nil
+	}
+	n := resolveNode(d.node)
+	n.Content = append([]*yaml.Node{
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: versionKey},
+		{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(latest)},
+	}, n.Content...)
+	out, err := encode(d.node)
+	if err != nil {
+		return nil, fmt.Errorf("migrate %s: %w", f.name, err)
+	}
+	backup := f.name + ".v" + strconv.Itoa(version) + ".bak"
+	if err := os.WriteFile(backup, data, info.Mode().Perm()); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(f.name, out, info.Mode().Perm()); err != nil {
+		return nil, err
+	}
+	return &MigratedFile{File: f.name, Backup: backup, From: version, To: latest}, nil
+}
+
+func encodeYAML(n *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	e := yaml.NewEncoder(&buf)
+	e.SetIndent(2)
+	if err := e.Encode(n); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeJSON(n *yaml.Node) ([]byte, error) {
+	data, err := nodeJSON(n)
+	if err != nil {
+		return nil, err
+	}
+	return indentJSON(data)
+}
+
+func encodeTOML(n *yaml.Node) ([]byte, error) {
+	var v map[string]interface{}
+	if err := n.Decode(&v); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MigrateCommand runs a command line interface that rewrites configuration
+// files to the latest version with MigrateFiles, intended to be called from
+// an application subcommand with its arguments. Flag -dirs is a comma
+// separated list of directories with configuration files. If it is not set,
+// Dirs are used.
+func (c *Config) MigrateCommand(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.SetOutput(w)
+	dirs := fs.String("dirs", "", "comma separated directories with configuration files, configuration directories if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	m := c
+	if *dirs != "" {
+		c.mu.Lock()
+		m = &Config{
+			Name:       c.Name,
+			Dirs:       strings.Split(*dirs, ","),
+			Profile:    c.Profile,
+			options:    c.options,
+			formatList: c.formatList,
+			migrations: c.migrations,
+		}
+		c.mu.Unlock()
+	}
+	migrated, err := m.MigrateFiles()
+	for _, f := range migrated {
+		if _, err := fmt.Fprintln(w, f); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(migrated) == 0 {
+		_, err = fmt.Fprintln(w, "no files to migrate")
+	}
+	return err
+}
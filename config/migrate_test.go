@@ -0,0 +1,173 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v3"
+
+	"resenje.org/x/config"
+)
+
+type serverTLS struct {
+	Cert string `yaml:"cert" json:"cert"`
+}
+
+type serverOptions struct {
+	Listen string    `yaml:"listen" json:"listen"`
+	TLS    serverTLS `yaml:"tls" json:"tls"`
+}
+
+func (o *serverOptions) VerifyAndPrepare() error { return nil }
+
+// newMigratedConfig returns a Config with server options that had the
+// listen key named addr in version 1 and the tls.cert key named cert in
+// version 2.
+func newMigratedConfig(dirs ...string) (*config.Config, *serverOptions) {
+	c := config.New("test", dirs...)
+	c.UnknownKeys = config.Fail
+	o := &serverOptions{}
+	c.Register("server", o)
+	c.RegisterMigration("server", 2, func(n *yaml.Node) error {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == "addr" {
+				n.Content[i].Value = "listen"
+			}
+		}
+		return nil
+	})
+	c.RegisterMigration("server", 3, func(n *yaml.Node) error {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value != "cert" {
+				continue
+			}
+			cert := n.Content[i+1]
+			n.Content = append(n.Content[:i:i], n.Content[i+2:]...)
+			n.Content = append(n.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Value: "tls"},
+				&yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: "cert"}, cert}},
+			)
+			return nil
+		}
+		return nil
+	})
+	return c, o
+}
+
+func TestConfig_RegisterMigration(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "server.yaml"), "addr: :80\ncert: server.pem\n")
+
+	c, o := newMigratedConfig(dir)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	want := &serverOptions{Listen: ":80", TLS: serverTLS{Cert: "server.pem"}}
+	if !reflect.DeepEqual(o, want) {
+		t.Errorf("got %+v, want %+v", o, want)
+	}
+
+	writeFile(t, filepath.Join(dir, "server.json"), "{\"version\": 2, \"listen\": \":443\", \"cert\": \"tls.pem\"}\n")
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	want = &serverOptions{Listen: ":443", TLS: serverTLS{Cert: "tls.pem"}}
+	if !reflect.DeepEqual(o, want) {
+		t.Errorf("got %+v, want %+v", o, want)
+	}
+
+	writeFile(t, filepath.Join(dir, "server.json"), "{\"version\": 4}\n")
+	err := c.Load()
+	if !errors.Is(err, config.ErrUnsupportedVersion) {
+		t.Fatalf("got error %v, want %v", err, config.ErrUnsupportedVersion)
+	}
+	if !strings.Contains(err.Error(), "unsupported version 4, latest version is 3") {
+		t.Errorf("got error %v", err)
+	}
+
+	writeFile(t, filepath.Join(dir, "server.json"), "{\"version\": \"two\"}\n")
+	if err := c.Load(); err == nil || !strings.Contains(err.Error(), "version must be a positive integer") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestConfig_MigrateFiles(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "server.yaml")
+	jsonFile := filepath.Join(dir, "server.json")
+	tomlFile := filepath.Join(dir, "server.toml")
+	writeFile(t, yamlFile, "# listen address\naddr: :80\ncert: server.pem\n")
+	writeFile(t, jsonFile, "{\"version\": 2, \"cert\": \"tls.pem\"}\n")
+	writeFile(t, tomlFile, "version = 3\nlisten = \":443\"\n")
+
+	c, _ := newMigratedConfig(dir)
+	migrated, err := c.MigrateFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []config.MigratedFile{
+		{File: yamlFile, Backup: yamlFile + ".v1.bak", From: 1, To: 3},
+		{File: jsonFile, Backup: jsonFile + ".v2.bak", From: 2, To: 3},
+	}
+	if !reflect.DeepEqual(migrated, want) {
+		t.Errorf("got migrated files %v, want %v", migrated, want)
+	}
+
+	for filename, want := range map[string]string{
+		yamlFile:             "version: 3\n# listen address\nlisten: :80\ntls:\n  cert: server.pem\n",
+		yamlFile + ".v1.bak": "# listen address\naddr: :80\ncert: server.pem\n",
+		jsonFile:             "{\n  \"tls\": {\n    \"cert\": \"tls.pem\"\n  },\n  \"version\": 3\n}\n",
+		jsonFile + ".v2.bak": "{\"version\": 2, \"cert\": \"tls.pem\"}\n",
+		tomlFile:             "version = 3\nlisten = \":443\"\n",
+	} {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("got file %s\n%s\nwant\n%s", filename, data, want)
+		}
+	}
+
+	c, o := newMigratedConfig(dir)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if want := (&serverOptions{Listen: ":443", TLS: serverTLS{Cert: "tls.pem"}}); !reflect.DeepEqual(o, want) {
+		t.Errorf("got %+v, want %+v", o, want)
+	}
+
+	var buf bytes.Buffer
+	if err := c.MigrateCommand(nil, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "no files to migrate\n"; got != want {
+		t.Errorf("got output %q, want %q", got, want)
+	}
+}
+
+func TestConfig_MigrateCommand(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "server.yaml")
+	writeFile(t, filename, "addr: :80\n")
+
+	c, _ := newMigratedConfig()
+	var buf bytes.Buffer
+	if err := c.MigrateCommand([]string{"-dirs", dir}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	want := filename + ": version 1 -> 3 (backup " + filename + ".v1.bak)\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got output %q, want %q", got, want)
+	}
+}
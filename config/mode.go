@@ -0,0 +1,32 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+// Mode defines how Load handles problems in configuration that do not
+// prevent values to be loaded.
+type Mode int
+
+// Modes of handling configuration problems.
+const (
+	// Ignore silently ignores the problem.
+	Ignore Mode = iota
+	// Warn logs the problem with Config Logger.
+	Warn
+	// Fail returns the problem as an error.
+	Fail
+)
+
+func (m Mode) String() string {
+	switch m {
+	case Ignore:
+		return "ignore"
+	case Warn:
+		return "warn"
+	case Fail:
+		return "fail"
+	}
+	return "unknown"
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// jsonNode parses json data into a yaml node tree, preserving lines and
+// columns of values. It returns a nil node if data contains only white
+// space.
+func jsonNode(data []byte) (*yaml.Node, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	// validate the whole input first, as errors from the json.Decoder
+	// tokenizer are less precise
+	if err := json.Unmarshal(data, new(json.RawMessage)); err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	n, err := decodeJSONNode(dec, data)
+	if err != nil {
+		return nil, err
+	}
+	return &yaml.Node{
+		Kind:    yaml.DocumentNode,
+		Line:    n.Line,
+		Column:  n.Column,
+		Content: []*yaml.Node{n},
+	}, nil
+}
+
+func decodeJSONNode(dec *json.Decoder, data []byte) (*yaml.Node, error) {
+	offset := dec.InputOffset()
+	for offset < int64(len(data)) && strings.IndexByte(" \t\r\n,:", data[offset]) >= 0 {
+		offset++
+	}
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	line, col := lineCol(data, offset)
+	n := &yaml.Node{
+		Line:   line,
+		Column: col,
+	}
+	switch t := t.(type) {
+	case json.Delim:
+		n.Kind = yaml.MappingNode
+		n.Tag = "!!map"
+		if t == '[' {
+			n.Kind = yaml.SequenceNode
+			n.Tag = "!!seq"
+		}
+		n.Style = yaml.FlowStyle
+		for dec.More() {
+			c, err := decodeJSONNode(dec, data)
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, c)
+		}
+		// closing delimiter
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	case string:
+		n.Kind = yaml.ScalarNode
+		n.Tag = "!!str"
+		n.Style = yaml.DoubleQuotedStyle
+		n.Value = t
+	case json.Number:
+		n.Kind = yaml.ScalarNode
+		n.Tag = "!!int"
+		if strings.ContainsAny(t.String(), ".eE") {
+			n.Tag = "!!float"
+		}
+		n.Value = t.String()
+	case bool:
+		n.Kind = yaml.ScalarNode
+		n.Tag = "!!bool"
+		n.Value = fmt.Sprint(t)
+	case nil:
+		n.Kind = yaml.ScalarNode
+		n.Tag = "!!null"
+		n.Value = "null"
+	}
+	return n, nil
+}
+
+// lineCol returns one-based line and column of the byte at the offset.
+func lineCol(data []byte, offset int64) (line, col int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	start := bytes.LastIndex(data[:offset], []byte{10}) + 1
+	return bytes.Count(data[:start], []byte{10}) + 1, int(offset) - start + 1
+}
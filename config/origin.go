@@ -0,0 +1,130 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"os"
+	"strconv"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Origin describes where a configuration value was set. The zero value
+// represents the default value that options had when they were registered.
+type Origin struct {
+	// File is the name of the configuration file that set the value, with
+	// the line and the column of its key.
+	File   string
+	Line   int
+	Column int
+	// Env is the name of the environment variable that set the value.
+	Env string
+	// Flag is the name of the command line flag that set the value.
+	Flag string
+}
+
+// IsDefault returns true if the value was not set by any configuration
+// source.
+func (o Origin) IsDefault() bool {
+	return o == Origin{}
+}
+
+// String returns a short description of the origin in the form of
+// file:line:col, env NAME, flag NAME or default.
+func (o Origin) String() string {
+	switch {
+	case o.Flag != "":
+		return "flag " + o.Flag
+	case o.Env != "":
+		return "env " + o.Env
+	case o.File != "" && o.Line > 0:
+		return o.File + ":" + strconv.Itoa(o.Line) + ":" + strconv.Itoa(o.Column)
+	case o.File != "":
+		return o.File
+	}
+	return "default"
+}
+
+// Origin returns the origin of the value of the named options under the
+// key, which is a dot separated path of yaml keys, like "tls.cert". Origins
+// are recorded by Load and Reload.
+func (c *Config) Origin(name, key string) Origin {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.origins[name][key]
+}
+
+// Origins returns origins of values for all keys of the named options.
+func (c *Config) Origins(name string) map[string]Origin {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, o := range c.options {
+		if o.name != name {
+			continue
+		}
+		origins := make(map[string]Origin)
+		for _, f := range leafFields(optionsFields(o.o, c.envPrefix(o.name))) {
+			origins[f.path] = c.origins[name][f.path]
+		}
+		return origins
+	}
+	return nil
+}
+
+// recordFileOrigins sets origins of all option keys that are present in the
+// configuration file.
+func recordFileOrigins(origins map[string]Origin, fields []*field, filename string, n *yaml.Node, json bool) {
+	walkMapping(n, fields, json, func(f *field, key, _ *yaml.Node) {
+		if f == nil {
+			return
+		}
+		origins[f.path] = Origin{
+			File:   filename,
+			Line:   key.Line,
+			Column: key.Column,
+		}
+	})
+}
+
+// recordEnvOrigins sets origins of all option fields that envconfig set
+// from environment variables or the default struct tag.
+func recordEnvOrigins(origins map[string]Origin, fields []*field) {
+	for _, f := range leafFields(fields) {
+		if f.envKey == "" {
+			continue
+		}
+		if _, ok := os.LookupEnv(f.envKey); ok {
+			origins[f.path] = Origin{Env: f.envKey}
+			continue
+		}
+		if f.envAlt != "" {
+			if _, ok := os.LookupEnv(f.envAlt); ok {
+				origins[f.path] = Origin{Env: f.envAlt}
+				continue
+			}
+		}
+		if f.tag.Get("default") != "" {
+			delete(origins, f.path)
+		}
+	}
+}
+
+// annotate sets line comments of values in the node with their origins.
+func annotate(n *yaml.Node, fields []*field, origins map[string]Origin) {
+	walkMapping(n, fields, false, func(f *field, key, value *yaml.Node) {
+		if f == nil {
+			return
+		}
+		// comments of block collections are not encoded on the key line
+		if value.Kind == yaml.ScalarNode {
+			value.LineComment = origins[f.path].String()
+		} else {
+			key.LineComment = origins[f.path].String()
+		}
+	})
+}
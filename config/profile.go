@@ -0,0 +1,28 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// ProfileEnv returns the name of the environment variable that selects the
+// active profile if Profile is not set, for example MYAPP_PROFILE for
+// Config with name "myapp".
+func (c *Config) ProfileEnv() string {
+	return strings.ToUpper(strings.Replace(c.Name, "-", "_", -1)) + "_PROFILE"
+}
+
+// ActiveProfile returns the profile which files are loaded, Profile field
+// value or, if it is empty, the value of the environment variable returned
+// by ProfileEnv.
+func (c *Config) ActiveProfile() string {
+	if c.Profile != "" {
+		return c.Profile
+	}
+	return os.Getenv(c.ProfileEnv())
+}
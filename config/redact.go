@@ -0,0 +1,76 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Redacted is the value that replaces sensitive values when configuration
+// is exported.
+const Redacted = "******"
+
+// Redacter is implemented by options that hold sensitive values which can
+// not be marked by the secret struct tag, for example values in maps or
+// parts of connection strings. Redact returns a copy of options that is
+// safe to be exported. Fields marked with the secret struct tag are masked
+// in the returned copy as well.
+//
+// Fields are marked as sensitive with the struct tag secret:"true".
+type Redacter interface {
+	Redact() Options
+}
+
+// redactedNode encodes options into a yaml node with sensitive values
+// replaced by Redacted.
+func redactedNode(o Options, fields []*field) (*yaml.Node, error) {
+	if r, ok := o.(Redacter); ok {
+		o = r.Redact()
+	}
+	var n yaml.Node
+	if err := n.Encode(o); err != nil {
+		return nil, err
+	}
+	redactNode(&n, fields)
+	return &n, nil
+}
+
+// redactNode masks values in the node that correspond to fields marked
+// with the secret struct tag.
+func redactNode(n *yaml.Node, fields []*field) {
+	walkMapping(n, fields, false, func(f *field, _, value *yaml.Node) {
+		if f == nil || !isSecret(f) {
+			return
+		}
+		maskNode(value)
+	})
+}
+
+func isSecret(f *field) bool {
+	return isTrue(f.tag.Get("secret"))
+}
+
+// maskNode replaces all non-empty scalar values in the node tree with
+// Redacted, keeping the structure of collections.
+func maskNode(n *yaml.Node) {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if n.Tag == "!!null" || n.Value == "" {
+			return
+		}
+		n.Tag = "!!str"
+		n.Style = 0
+		n.Value = Redacted
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			maskNode(n.Content[i])
+		}
+	case yaml.SequenceNode, yaml.DocumentNode:
+		for _, c := range n.Content {
+			maskNode(c)
+		}
+	}
+}
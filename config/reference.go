@@ -0,0 +1,162 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// referenceRow describes a single configurable value.
+type referenceRow struct {
+	field       string
+	key         string
+	env         string
+	typ         string
+	def         string
+	description string
+}
+
+// referenceSection holds rows of all values of the named options.
+type referenceSection struct {
+	name string
+	rows []referenceRow
+}
+
+// MarkdownReference returns the documentation of all registered options
+// as Markdown tables, with a section for every options. Every value is
+// described by its go field, the key in configuration files, the
+// environment variable, the type, the default value and the description
+// from the description struct tag. Defaults are values that options had
+// when they were registered, with sensitive values redacted.
+func (c *Config) MarkdownReference() string {
+	var b strings.Builder
+	for i, s := range c.reference() {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "## %s\n\n", s.name)
+		b.WriteString("| Field | Key | Environment variable | Type | Default | Description |\n")
+		b.WriteString("|-------|-----|----------------------|------|---------|-------------|\n")
+		for _, r := range s.rows {
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s |\n",
+				markdownCode(r.field),
+				markdownCode(r.key),
+				markdownCode(r.env),
+				markdownCode(r.typ),
+				markdownCode(r.def),
+				markdownText(r.description),
+			)
+		}
+	}
+	return b.String()
+}
+
+// TextReference returns the same documentation as MarkdownReference in
+// plain text tables.
+func (c *Config) TextReference() string {
+	var buf bytes.Buffer
+	for i, s := range c.reference() {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "# %s\n\n", s.name)
+		w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "FIELD\tKEY\tENV\tTYPE\tDEFAULT\tDESCRIPTION")
+		for _, r := range s.rows {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.field, r.key, r.env, r.typ, r.def, r.description)
+		}
+		w.Flush()
+	}
+	return buf.String()
+}
+
+func (c *Config) reference() (sections []referenceSection) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, o := range c.options {
+		fields := optionsFields(o.defaults, c.envPrefix(o.name))
+		n, err := redactedNode(o.defaults, fields)
+		if err != nil {
+			n = nil
+		}
+		sections = append(sections, referenceSection{
+			name: o.name,
+			rows: referenceRows(fields, fields, n, ""),
+		})
+	}
+	return sections
+}
+
+// referenceRows returns rows for leaf fields with default values looked up
+// in the node n of options with root fields.
+func referenceRows(root, fields []*field, n *yaml.Node, parent string) (rows []referenceRow) {
+	for _, f := range fields {
+		name := f.name
+		if parent != "" {
+			name = parent + "." + f.name
+		}
+		if !f.leaf() {
+			rows = append(rows, referenceRows(root, f.fields, n, name)...)
+			continue
+		}
+		r := referenceRow{
+			field:       name,
+			env:         f.envKey,
+			typ:         f.typ.String(),
+			description: f.tag.Get("description"),
+		}
+		if f.key != "" {
+			r.key = f.path
+			if v := lookupNode(n, root, f.path, false); v != nil {
+				r.def = referenceValue(v)
+			}
+		}
+		if r.def == "" && f.envKey != "" {
+			r.def = f.tag.Get("default")
+		}
+		rows = append(rows, r)
+	}
+	return rows
+}
+
+// referenceValue returns the value of the node as it would be written in
+// a yaml file on a single line, or an empty string for empty values.
+func referenceValue(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if n.Tag == "!!null" {
+			return ""
+		}
+		return n.Value
+	case yaml.SequenceNode, yaml.MappingNode:
+		if len(n.Content) == 0 {
+			return ""
+		}
+	}
+	n.Style |= yaml.FlowStyle
+	data, err := yaml.Marshal(n)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func markdownCode(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "`" + strings.ReplaceAll(s, "|", `\|`) + "`"
+}
+
+func markdownText(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
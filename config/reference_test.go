@@ -0,0 +1,68 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"resenje.org/x/config"
+)
+
+type referenceOptions struct {
+	Listen   string        `yaml:"listen" description:"Address to listen on."`
+	Timeout  time.Duration `yaml:"timeout" split_words:"true"`
+	Domains  []string      `yaml:"domains" description:"Served domains | aliases."`
+	Password string        `yaml:"password" secret:"true"`
+	Internal string        `yaml:"-" ignored:"true"`
+	TLS      struct {
+		Cert string `yaml:"cert" envconfig:"CERTIFICATE" default:"cert.pem"`
+	} `yaml:"tls"`
+}
+
+func (o *referenceOptions) VerifyAndPrepare() error { return nil }
+
+func newReferenceConfig() *config.Config {
+	c := config.New("test")
+	c.Register("http", &referenceOptions{
+		Listen:   ":80",
+		Timeout:  time.Minute,
+		Domains:  []string{"a.com", "b.com"},
+		Password: "s3cr3t",
+	})
+	return c
+}
+
+func TestConfig_MarkdownReference(t *testing.T) {
+	got := newReferenceConfig().MarkdownReference()
+	want := "## http\n\n" +
+		"| Field | Key | Environment variable | Type | Default | Description |\n" +
+		"|-------|-----|----------------------|------|---------|-------------|\n" +
+		"| `Listen` | `listen` | `TEST_HTTP_LISTEN` | `string` | `:80` | Address to listen on. |\n" +
+		"| `Timeout` | `timeout` | `TEST_HTTP_TIMEOUT` | `time.Duration` | `1m0s` |  |\n" +
+		"| `Domains` | `domains` | `TEST_HTTP_DOMAINS` | `[]string` | `[a.com, b.com]` | Served domains \\| aliases. |\n" +
+		"| `Password` | `password` | `TEST_HTTP_PASSWORD` | `string` | `******` |  |\n" +
+		"| `Internal` |  |  | `string` |  |  |\n" +
+		"| `TLS.Cert` | `tls.cert` | `TEST_HTTP_TLS_CERTIFICATE` | `string` | `cert.pem` |  |\n"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestConfig_TextReference(t *testing.T) {
+	got := newReferenceConfig().TextReference()
+	want := "# http\n\n" +
+		"FIELD     KEY       ENV                        TYPE           DEFAULT         DESCRIPTION\n" +
+		"Listen    listen    TEST_HTTP_LISTEN           string         :80             Address to listen on.\n" +
+		"Timeout   timeout   TEST_HTTP_TIMEOUT          time.Duration  1m0s            \n" +
+		"Domains   domains   TEST_HTTP_DOMAINS          []string       [a.com, b.com]  Served domains | aliases.\n" +
+		"Password  password  TEST_HTTP_PASSWORD         string         ******          \n" +
+		"Internal                                       string                         \n" +
+		"TLS.Cert  tls.cert  TEST_HTTP_TLS_CERTIFICATE  string         cert.pem        \n"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// SchemaDraft is the JSON Schema dialect of generated schemas.
+const SchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a subset of JSON Schema that describes configuration files of
+// registered options.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+}
+
+// Schema returns the JSON Schema of configuration files for the named
+// options. Properties are yaml keys of options fields, with current values
+// as defaults, except for fields marked as secret, and constraints from
+// validate struct tags. Directive keys include and version, when they
+// apply, are also properties. No property is required, as values can be
+// set by any file, environment variable or flag.
+//
+// The schema describes yaml and toml files. It does not describe json files
+// of options which json struct tags differ from yaml struct tags, as keys
+// in json files are json keys.
+func (c *Config) Schema(name string) (*Schema, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, o := range c.options {
+		if o.name != name {
+			continue
+		}
+		v := reflect.ValueOf(o.o)
+		s := typeSchema(v.Type())
+		if s.Type != "object" || s.Properties == nil {
+			return nil, fmt.Errorf("options %q are not a struct", name)
+		}
+		s.Schema = SchemaDraft
+		s.Title = name
+		fields := optionsFields(o.o, "")
+		if err := fieldsSchema(s, reflect.Indirect(v), fields); err != nil {
+			return nil, fmt.Errorf("options %q: %w", name, err)
+		}
+		c.directivesSchema(s, name, fields)
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown options %q", name)
+}
+
+// WriteSchemas writes JSON Schemas of all registered options to files
+// named like http.schema.json in the directory. Schemas have yaml keys, as
+// described in Schema.
+func (c *Config) WriteSchemas(dir string) error {
+	c.mu.Lock()
+	names := make([]string, 0, len(c.options))
+	for _, o := range c.options {
+		names = append(names, o.name)
+	}
+	c.mu.Unlock()
+
+	for _, name := range names {
+		s, err := c.Schema(name)
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encode %q schema: %w", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+".schema.json"), append(data, '\n'), 0o666); err != nil {
+			return fmt.Errorf("write %q schema: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// directivesSchema adds properties of top level directive keys that are not
+// keys of options fields to the root schema s.
+func (c *Config) directivesSchema(s *Schema, name string, fields []*field) {
+	if fieldByKey(fields, includeKey, false) == nil {
+		s.Properties[includeKey] = &Schema{AnyOf: []*Schema{
+			{Type: "string"},
+			{Type: "array", Items: &Schema{Type: "string"}},
+		}}
+	}
+	if latest := c.latestVersion(name); latest > 0 && fieldByKey(fields, versionKey, false) == nil {
+		min, max := 1.0, float64(latest)
+		s.Properties[versionKey] = &Schema{Type: "integer", Minimum: &min, Maximum: &max}
+	}
+}
+
+// fieldsSchema sets properties of the object schema s from fields and
+// their values in the options struct value root.
+func fieldsSchema(s *Schema, root reflect.Value, fields []*field) error {
+	if s.Properties == nil {
+		s.Properties = make(map[string]*Schema)
+	}
+	for _, f := range fields {
+		if f.key == "" {
+			continue
+		}
+		// value is invalid if a parent pointer is nil
+		fv, _ := root.FieldByIndexErr(f.index)
+		p := typeSchema(f.typ)
+		if !f.leaf() {
+			if err := fieldsSchema(p, root, f.fields); err != nil {
+				return err
+			}
+		} else if fv.IsValid() && !isSecret(f) && !isEmptyValue(fv) {
+			d, err := schemaDefault(fv)
+			if err != nil {
+				return fmt.Errorf("%s: %w", f.path, err)
+			}
+			p.Default = d
+		}
+		if err := applyValidation(p, f); err != nil {
+			return fmt.Errorf("%s: %w", f.path, err)
+		}
+		s.Properties[f.key] = p
+	}
+	return nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// typeSchema returns the schema of values of type t as they are written in
+// yaml files.
+func typeSchema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == durationType:
+		return &Schema{Type: "string", Pattern: `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`}
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case reflect.PointerTo(t).Implements(textUnmarshalerType):
+		return &Schema{Type: "string"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string"}
+		}
+		return &Schema{Type: "array", Items: typeSchema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: typeSchema(t.Elem())}
+	case reflect.Struct:
+		if structType(t) == nil {
+			return &Schema{}
+		}
+		return &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: false}
+	}
+	return &Schema{}
+}
+
+// schemaDefault returns the value as it would be written in a yaml file.
+func schemaDefault(v reflect.Value) (interface{}, error) {
+	var n yaml.Node
+	if err := n.Encode(v.Interface()); err != nil {
+		return nil, err
+	}
+	return nodeValue(&n)
+}
+
+// applyValidation sets schema constraints from the validate struct tag.
+func applyValidation(s *Schema, f *field) error {
+	tag := f.tag.Get("validate")
+	// element constraints apply to items of arrays
+	elem := s
+	if s.Type == "array" && s.Items != nil {
+		elem = s.Items
+	}
+	for tag != "" {
+		var rule string
+		if strings.HasPrefix(tag, "regexp=") {
+			rule, tag = tag, ""
+		} else {
+			rule, tag, _ = strings.Cut(tag, ",")
+		}
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "min", "max":
+			if err := applyBound(s, f.typ, name, arg); err != nil {
+				return err
+			}
+		case "oneof":
+			for _, v := range strings.Fields(arg) {
+				var e interface{} = v
+				if elem.Type == "integer" || elem.Type == "number" {
+					if n, err := strconv.ParseFloat(v, 64); err == nil {
+						e = n
+					}
+				}
+				elem.Enum = append(elem.Enum, e)
+			}
+		case "regexp":
+			elem.Pattern = arg
+		case "url":
+			elem.Format = "uri"
+		case "email":
+			elem.Format = "email"
+		case "required":
+			// the value can be set by another file or a different source
+		case "hostport", "file-exists", "file":
+			// no equivalent json schema format
+		default:
+			return fmt.Errorf("unknown validation rule %q", name)
+		}
+	}
+	return nil
+}
+
+func applyBound(s *Schema, t reflect.Type, name, arg string) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == durationType {
+		// bounds of duration strings can not be expressed in json schema
+		return nil
+	}
+	switch s.Type {
+	case "integer", "number":
+		n, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Errorf("invalid validation %s value %q", name, arg)
+		}
+		if name == "min" {
+			s.Minimum = &n
+		} else {
+			s.Maximum = &n
+		}
+	case "string", "array", "object":
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("invalid validation %s length %q", name, arg)
+		}
+		switch {
+		case s.Type == "string" && name == "min":
+			s.MinLength = &n
+		case s.Type == "string":
+			s.MaxLength = &n
+		case s.Type == "array" && name == "min":
+			s.MinItems = &n
+		case s.Type == "array":
+			s.MaxItems = &n
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	yaml "gopkg.in/yaml.v3"
+
+	"resenje.org/x/config"
+)
+
+type schemaOptions struct {
+	Listen   string            `yaml:"listen" validate:"required,hostport"`
+	Port     int               `yaml:"port" validate:"min=1,max=65535"`
+	Timeout  time.Duration     `yaml:"timeout"`
+	Mode     string            `yaml:"mode" validate:"oneof=debug release"`
+	Admins   []string          `yaml:"admins" validate:"max=3,email"`
+	Password string            `yaml:"password" secret:"true"`
+	Labels   map[string]string `yaml:"labels"`
+	TLS      struct {
+		Cert string `yaml:"cert" validate:"required"`
+	} `yaml:"tls"`
+}
+
+func (o *schemaOptions) VerifyAndPrepare() error { return nil }
+
+func TestConfig_Schema(t *testing.T) {
+	c := config.New("test")
+	c.Register("http", &schemaOptions{
+		Listen:   ":80",
+		Timeout:  time.Minute,
+		Mode:     "release",
+		Password: "s3cr3t",
+	})
+
+	s, err := c.Schema("http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"$schema":"https://json-schema.org/draft/2020-12/schema","title":"http","type":"object",` +
+		`"properties":{` +
+		`"admins":{"type":"array","items":{"type":"string","format":"email"},"maxItems":3},` +
+		`"include":{"anyOf":[{"type":"string"},{"type":"array","items":{"type":"string"}}]},` +
+		`"labels":{"type":"object","additionalProperties":{"type":"string"}},` +
+		`"listen":{"type":"string","default":":80"},` +
+		`"mode":{"type":"string","default":"release","enum":["debug","release"]},` +
+		`"password":{"type":"string"},` +
+		`"port":{"type":"integer","minimum":1,"maximum":65535},` +
+		`"timeout":{"type":"string","default":"1m0s","pattern":"^([0-9]+(\\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$"},` +
+		`"tls":{"type":"object","properties":{"cert":{"type":"string"}},"additionalProperties":false}` +
+		`},"additionalProperties":false}`
+	if string(got) != want {
+		t.Errorf("got schema\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestConfig_Schema_version(t *testing.T) {
+	c := config.New("test")
+	c.Register("http", &schemaOptions{})
+	c.RegisterMigration("http", 2, func(*yaml.Node) error { return nil })
+	c.RegisterMigration("http", 3, func(*yaml.Node) error { return nil })
+
+	s, err := c.Schema("http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(s.Properties["version"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"type":"integer","minimum":1,"maximum":3}`; string(got) != want {
+		t.Errorf("got version schema %s, want %s", got, want)
+	}
+}
+
+func TestConfig_WriteSchemas(t *testing.T) {
+	dir := t.TempDir()
+
+	c := config.New("test")
+	c.Register("http", &testOptions{})
+	c.Register("api", &schemaOptions{})
+	if err := c.WriteSchemas(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"http", "api"} {
+		data, err := os.ReadFile(filepath.Join(dir, name+".schema.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s config.Schema
+		if err := json.Unmarshal(data, &s); err != nil {
+			t.Fatal(err)
+		}
+		if s.Title != name {
+			t.Errorf("got title %q, want %q", s.Title, name)
+		}
+	}
+}
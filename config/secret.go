@@ -0,0 +1,215 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// SecretScheme is the prefix of configuration values that are references
+// to secrets, like secret://vault/smtp/password, which are resolved by Load
+// with the secret provider registered under the name vault if Config
+// Secrets is true.
+const SecretScheme = "secret://"
+
+// ErrUnknownSecretProvider is returned by Load in FieldError for secret
+// references with provider names that are not registered.
+var ErrUnknownSecretProvider = errors.New("unknown secret provider")
+
+// SecretProvider resolves references to secrets. Path is the part of the
+// reference after the provider name, for example /smtp/password for the
+// reference secret://vault/smtp/password.
+type SecretProvider interface {
+	Secret(path string) (string, error)
+}
+
+// SecretProviderFunc type is an adapter to allow the use of ordinary
+// functions as secret providers.
+type SecretProviderFunc func(path string) (string, error)
+
+// Secret calls f(path).
+func (f SecretProviderFunc) Secret(path string) (string, error) {
+	return f(path)
+}
+
+// FileSecrets is a secret provider that returns the content of the file
+// under the path, without the trailing newline. It is registered under the
+// name file, so that secret://file/run/secrets/smtp is replaced with the
+// content of /run/secrets/smtp.
+var FileSecrets SecretProvider = SecretProviderFunc(readSecretFile)
+
+// RegisterSecretProvider adds a provider that resolves secret references
+// with the name, replacing the provider that is already registered with
+// the same name.
+func (c *Config) RegisterSecretProvider(name string, p SecretProvider) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.secretProviders == nil {
+		c.secretProviders = map[string]SecretProvider{"file": FileSecrets}
+	}
+	c.secretProviders[name] = p
+}
+
+func (c *Config) secretProvider(name string) SecretProvider {
+	if c.secretProviders == nil {
+		if name == "file" {
+			return FileSecrets
+		}
+		return nil
+	}
+	return c.secretProviders[name]
+}
+
+// resolveSecrets replaces encrypted values and secret references in string
+// values of options fields, elements of string slices and values of string
+// maps with decrypted values and secrets returned by providers.
+func (c *Config) resolveSecrets(name string, o Options, fields []*field, origins map[string]Origin) error {
+	root := reflect.Indirect(reflect.ValueOf(o))
+	if root.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs FieldErrors
+	for _, f := range leafFields(fields) {
+		v, err := root.FieldByIndexErr(f.index)
+		if err != nil {
+			// nil pointer to a parent struct
+			continue
+		}
+		for _, err := range c.resolveValue(v, "") {
+			err.Key = f.path + err.Key
+			err.Origin = origins[f.path]
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("load %q secrets: %w", name, errs)
+	}
+	return nil
+}
+
+// resolveValue resolves secret references in the value and returns errors
+// with keys that hold the index of slice elements or map keys, if any.
+func (c *Config) resolveValue(v reflect.Value, index string) (errs FieldErrors) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return c.resolveValue(v.Elem(), index)
+		}
+	case reflect.String:
+		s, err := c.resolveSecret(v.String())
+		if err != nil {
+			return FieldErrors{{Key: index, Err: err}}
+		}
+		if v.CanSet() {
+			v.SetString(s)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			errs = append(errs, c.resolveValue(v.Index(i), fmt.Sprintf("%s[%d]", index, i))...)
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			s, err := c.resolveSecret(iter.Value().String())
+			if err != nil {
+				errs = append(errs, &FieldError{Key: fmt.Sprintf("%s[%v]", index, iter.Key()), Err: err})
+				continue
+			}
+			v.SetMapIndex(iter.Key(), reflect.ValueOf(s).Convert(v.Type().Elem()))
+		}
+	}
+	return errs
+}
+
+// resolveSecret returns the decrypted value if s is encrypted, the secret
+// if s is a secret reference, otherwise s.
+func (c *Config) resolveSecret(s string) (string, error) {
+	s, err := c.decrypt(s)
+	if err != nil {
+		return "", err
+	}
+	ref, ok := strings.CutPrefix(s, SecretScheme)
+	if !ok {
+		return s, nil
+	}
+	name, path, _ := strings.Cut(ref, "/")
+	p := c.secretProvider(name)
+	if p == nil {
+		return "", fmt.Errorf("%w %q", ErrUnknownSecretProvider, name)
+	}
+	secret, err := p.Secret("/" + path)
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %w", s, err)
+	}
+	return secret, nil
+}
+
+// applyEnvFiles sets values of fields from files which names are in
+// environment variables with the _FILE suffix, like SMTP_PASSWORD_FILE,
+// if the environment variable without the suffix is not set. Variables with
+// the suffix that belong to other fields are not file references.
+func applyEnvFiles(name string, o Options, fields []*field, origins map[string]Origin) error {
+	paths := make(map[string][]*field)
+	envFieldPaths(fields, nil, paths)
+
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, f := range leafFields(fields) {
+		if f.envKey == "" || f.key == "" {
+			continue
+		}
+		for _, env := range []string{f.envKey, f.envAlt} {
+			if env == "" {
+				continue
+			}
+			if _, ok := os.LookupEnv(env); ok {
+				break
+			}
+			if _, ok := paths[env+"_FILE"]; ok {
+				// the variable with the suffix is of another field, like
+				// TLS_CERT_FILE of CertFile and not the file of Cert
+				continue
+			}
+			filename, ok := os.LookupEnv(env + "_FILE")
+			if !ok {
+				continue
+			}
+			value, err := readSecretFile(filename)
+			if err != nil {
+				return fmt.Errorf("load %q env variables: %s_FILE: %w", name, env, err)
+			}
+			key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str"}
+			setPath(root, paths[f.envKey], false, key, envValueNode(f, value, 0, 0))
+			origins[f.path] = Origin{Env: env + "_FILE"}
+			break
+		}
+	}
+	if len(root.Content) == 0 {
+		return nil
+	}
+	if err := root.Decode(o); err != nil {
+		return fmt.Errorf("load %q env variables: %w", name, err)
+	}
+	return nil
+}
+
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	s := strings.TrimSuffix(string(data), "\n")
+	return strings.TrimSuffix(s, "\r"), nil
+}
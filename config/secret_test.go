@@ -0,0 +1,165 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"resenje.org/x/config"
+)
+
+type smtpOptions struct {
+	Host     string            `yaml:"host"`
+	Password string            `yaml:"password" split_words:"true" secret:"true"`
+	Tokens   []string          `yaml:"tokens"`
+	Headers  map[string]string `yaml:"headers"`
+}
+
+func (o *smtpOptions) VerifyAndPrepare() error { return nil }
+
+// memorySecrets is an in-memory secret provider.
+type memorySecrets map[string]string
+
+func (m memorySecrets) Secret(path string) (string, error) {
+	s, ok := m[path]
+	if !ok {
+		return "", fmt.Errorf("%s not found", path)
+	}
+	return s, nil
+}
+
+func TestConfig_secretEnvFile(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "smtp")
+	if err := os.WriteFile(secretFile, []byte("s3cr3t\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	hostFile := filepath.Join(dir, "host")
+	if err := os.WriteFile(hostFile, []byte("mail.file.com"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_SMTP_PASSWORD_FILE", secretFile)
+	// variable without the suffix takes precedence
+	t.Setenv("TEST_SMTP_HOST", "mail.env.com")
+	t.Setenv("TEST_SMTP_HOST_FILE", hostFile)
+
+	o := &smtpOptions{}
+	c := config.New("test")
+	c.Register("smtp", o)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if o.Password != "s3cr3t" {
+		t.Errorf("got password %q, want %q", o.Password, "s3cr3t")
+	}
+	if o.Host != "mail.env.com" {
+		t.Errorf("got host %q, want %q", o.Host, "mail.env.com")
+	}
+	if got, want := c.Origin("smtp", "password").String(), "env TEST_SMTP_PASSWORD_FILE"; got != want {
+		t.Errorf("got password origin %q, want %q", got, want)
+	}
+}
+
+type certOptions struct {
+	Cert     string `yaml:"cert"`
+	CertFile string `yaml:"cert-file" split_words:"true"`
+}
+
+func (o *certOptions) VerifyAndPrepare() error { return nil }
+
+func TestConfig_secretEnvFile_field(t *testing.T) {
+	certFile := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(certFile, []byte("certificate"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	// the variable of CertFile field is not the file of Cert field
+	t.Setenv("TEST_TLS_CERT_FILE", certFile)
+
+	o := &certOptions{}
+	c := config.New("test")
+	c.Register("tls", o)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	want := &certOptions{CertFile: certFile}
+	if !reflect.DeepEqual(o, want) {
+		t.Errorf("got %+v, want %+v", o, want)
+	}
+	if got := c.Origin("tls", "cert"); !got.IsDefault() {
+		t.Errorf("got cert origin %q, want default", got)
+	}
+}
+
+func TestConfig_secretProviders(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "token")
+	if err := os.WriteFile(secretFile, []byte("file-token\n"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "smtp.yaml"), "password: secret://vault/smtp/password\n"+
+		"tokens:\n- plain\n- secret://file"+secretFile+"\n"+
+		"headers:\n  X-Key: secret://vault/smtp/key\n")
+
+	o := &smtpOptions{}
+	c := config.New("test", dir)
+	c.Secrets = true
+	c.RegisterSecretProvider("vault", memorySecrets{
+		"/smtp/password": "vault-password",
+		"/smtp/key":      "vault-key",
+	})
+	c.Register("smtp", o)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	want := &smtpOptions{
+		Password: "vault-password",
+		Tokens:   []string{"plain", "file-token"},
+		Headers:  map[string]string{"X-Key": "vault-key"},
+	}
+	if !reflect.DeepEqual(o, want) {
+		t.Errorf("got %+v, want %+v", o, want)
+	}
+}
+
+func TestConfig_secretErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "smtp.yaml"), "password: secret://unknown/password\ntokens:\n- secret://vault/missing\n")
+
+	c := config.New("test", dir)
+	c.Secrets = true
+	c.RegisterSecretProvider("vault", memorySecrets{})
+	c.Register("smtp", &smtpOptions{})
+	err := c.Load()
+	if !errors.Is(err, config.ErrUnknownSecretProvider) {
+		t.Errorf("got error %v, want %v", err, config.ErrUnknownSecretProvider)
+	}
+	want := `load "smtp" secrets: password: unknown secret provider "unknown" (` + filepath.Join(dir, "smtp.yaml") + ":1:1)\n" +
+		"tokens[0]: secret secret://vault/missing: /missing not found (" + filepath.Join(dir, "smtp.yaml") + ":2:1)"
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %v", err, want)
+	}
+}
+
+func TestConfig_secretsDisabled(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "smtp.yaml"), "host: secret://vault/host\npassword: enc:legacy-value\n")
+
+	o := &smtpOptions{}
+	c := config.New("test", dir)
+	c.Register("smtp", o)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	want := &smtpOptions{Host: "secret://vault/host", Password: "enc:legacy-value"}
+	if !reflect.DeepEqual(o, want) {
+		t.Errorf("got %+v, want %+v", o, want)
+	}
+}
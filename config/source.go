@@ -0,0 +1,92 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// source is a directory with configuration files, either on the operating
+// system file system or in a fs.FS.
+type source struct {
+	// fsys is nil for operating system directories.
+	fsys fs.FS
+	dir  string
+}
+
+// path returns the name of the file in the source directory.
+func (s source) path(name string) string {
+	if s.fsys == nil {
+		return filepath.Join(s.dir, name)
+	}
+	return path.Join(s.dir, name)
+}
+
+// join joins the directory and the file name in the source.
+func (s source) join(dir, name string) string {
+	if s.fsys == nil {
+		return filepath.Join(dir, name)
+	}
+	return path.Join(dir, name)
+}
+
+func (s source) readDir(name string) ([]fs.DirEntry, error) {
+	if s.fsys == nil {
+		return os.ReadDir(name)
+	}
+	return fs.ReadDir(s.fsys, name)
+}
+
+func (s source) readFile(name string) ([]byte, error) {
+	if s.fsys == nil {
+		return os.ReadFile(name)
+	}
+	return fs.ReadFile(s.fsys, name)
+}
+
+func (s source) stat(name string) (fs.FileInfo, error) {
+	if s.fsys == nil {
+		return os.Stat(name)
+	}
+	return fs.Stat(s.fsys, name)
+}
+
+// file is a configuration file that Load reads if it exists.
+type file struct {
+	src    source
+	name   string
+	format format
+}
+
+// files returns configuration files of the named options from all layers
+// in the order in which they are loaded.
+func (c *Config) files(name string) (files []file) {
+	for _, l := range c.layers() {
+		files = append(files, l.files(c, name)...)
+	}
+	return files
+}
+
+// sourceFiles returns configuration files of the named options in the
+// source directory. Files of all formats are followed by fragments in the
+// <name>.d directory and the files of the active profile.
+func (c *Config) sourceFiles(src source, name string) (files []file) {
+	for _, f := range c.formats() {
+		files = append(files, file{src: src, name: src.path(name + f.ext), format: f})
+	}
+	files = append(files, c.fragments(src, name)...)
+	profile := c.ActiveProfile()
+	if profile == "" {
+		return files
+	}
+	for _, f := range c.formats() {
+		files = append(files, file{src: src, name: src.path(name + "." + profile + f.ext), format: f})
+	}
+	return files
+}
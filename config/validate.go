@@ -0,0 +1,281 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validate checks values of options fields against rules in validate
+// struct tags and returns FieldErrors with keys of all fields that are not
+// valid. Rules are comma separated:
+//
+//	required       value must not be zero, or empty for slices and maps
+//	min=N, max=N   numeric bounds or length bounds of strings, slices and maps,
+//	               durations as time.ParseDuration strings for time.Duration
+//	oneof=a b c    value must be one of space separated values
+//	hostport       value must be a host:port pair
+//	url            value must be an absolute url
+//	email          value must be an email address
+//	file-exists    value must be a path to an existing regular file, file
+//	               is an alias
+//	regexp=EXPR    value must match the regular expression, the rest of the
+//	               tag is the expression, so it must be the last rule
+//
+// Rules other than required, min and max are applied to every element of
+// slices and are not checked for empty values.
+//
+// Config VerifyAndPrepare calls Validate before VerifyAndPrepare method of
+// every options, which is not called if options are not valid.
+func Validate(o interface{}) error {
+	v := reflect.ValueOf(o)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	var errs FieldErrors
+	for _, f := range optionsFields(o, "") {
+		errs = append(errs, validateField(v, f)...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateField(root reflect.Value, f *field) (errs FieldErrors) {
+	v, err := root.FieldByIndexErr(f.index)
+	if err != nil {
+		// nil pointer to a parent struct
+		return nil
+	}
+	if tag, ok := f.tag.Lookup("validate"); ok && tag != "" {
+		for _, err := range validateValue(v, tag) {
+			errs = append(errs, &FieldError{Key: f.path + err.index, Err: err.err})
+		}
+	}
+	for _, c := range f.fields {
+		errs = append(errs, validateField(root, c)...)
+	}
+	return errs
+}
+
+type validationError struct {
+	// index of the slice element, like [2], or empty
+	index string
+	err   error
+}
+
+func validateValue(v reflect.Value, tag string) (errs []validationError) {
+	for tag != "" {
+		var rule string
+		if strings.HasPrefix(tag, "regexp=") {
+			rule, tag = tag, ""
+		} else {
+			rule, tag, _ = strings.Cut(tag, ",")
+		}
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "required":
+			if isEmptyValue(v) {
+				errs = append(errs, validationError{err: errors.New("is required")})
+			}
+		case "min", "max":
+			if err := validateBound(v, name, arg); err != nil {
+				errs = append(errs, validationError{err: err})
+			}
+		default:
+			check, err := elementCheck(name, arg)
+			if err != nil {
+				errs = append(errs, validationError{err: err})
+				continue
+			}
+			errs = append(errs, validateElements(v, check)...)
+		}
+	}
+	return errs
+}
+
+// elementCheck returns a function that validates a single string value
+// for the named rule.
+func elementCheck(name, arg string) (func(s string) error, error) {
+	switch name {
+	case "oneof":
+		values := strings.Fields(arg)
+		return func(s string) error {
+			for _, v := range values {
+				if s == v {
+					return nil
+				}
+			}
+			return fmt.Errorf("must be one of %s", strings.Join(values, ", "))
+		}, nil
+	case "hostport":
+		return func(s string) error {
+			_, port, err := net.SplitHostPort(s)
+			if err != nil {
+				return fmt.Errorf("must be host:port: %w", err)
+			}
+			if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+				return fmt.Errorf("must be host:port: invalid port %q", port)
+			}
+			return nil
+		}, nil
+	case "url":
+		return func(s string) error {
+			u, err := url.Parse(s)
+			if err != nil {
+				return fmt.Errorf("must be url: %w", err)
+			}
+			if u.Scheme == "" || u.Host == "" {
+				return errors.New("must be absolute url")
+			}
+			return nil
+		}, nil
+	case "email":
+		return func(s string) error {
+			a, err := mail.ParseAddress(s)
+			if err != nil || a.Address != s {
+				return errors.New("must be email address")
+			}
+			return nil
+		}, nil
+	case "file-exists", "file":
+		return func(s string) error {
+			i, err := os.Stat(s)
+			if err != nil {
+				return fmt.Errorf("must be existing file: %w", err)
+			}
+			if !i.Mode().IsRegular() {
+				return errors.New("must be regular file")
+			}
+			return nil
+		}, nil
+	case "regexp":
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid validation regexp: %w", err)
+		}
+		return func(s string) error {
+			if !re.MatchString(s) {
+				return fmt.Errorf("must match %s", arg)
+			}
+			return nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown validation rule %q", name)
+}
+
+// validateElements applies the check to string representations of a value
+// or elements of a slice value, skipping empty values.
+func validateElements(v reflect.Value, check func(s string) error) (errs []validationError) {
+	v = reflect.Indirect(v)
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		for i := 0; i < v.Len(); i++ {
+			for _, err := range validateElements(v.Index(i), check) {
+				errs = append(errs, validationError{index: "[" + strconv.Itoa(i) + "]" + err.index, err: err.err})
+			}
+		}
+		return errs
+	}
+	if v.IsZero() {
+		return nil
+	}
+	s := fmt.Sprint(v.Interface())
+	if v.Kind() == reflect.String {
+		s = v.String()
+	}
+	if err := check(s); err != nil {
+		return []validationError{{err: err}}
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// validateBound checks min and max rules.
+func validateBound(v reflect.Value, name, arg string) error {
+	v = reflect.Indirect(v)
+	if !v.IsValid() {
+		return nil
+	}
+	compare := func(c int) error {
+		if name == "min" && c < 0 {
+			return fmt.Errorf("must be at least %s", arg)
+		}
+		if name == "max" && c > 0 {
+			return fmt.Errorf("must be at most %s", arg)
+		}
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("invalid validation %s length %q", name, arg)
+		}
+		if name == "min" && v.Len() < n {
+			return fmt.Errorf("length must be at least %v", n)
+		}
+		if name == "max" && v.Len() > n {
+			return fmt.Errorf("length must be at most %v", n)
+		}
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == durationType {
+			d, err := time.ParseDuration(arg)
+			if err != nil {
+				return fmt.Errorf("invalid validation %s duration %q", name, arg)
+			}
+			return compare(cmp.Compare(v.Int(), int64(d)))
+		}
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid validation %s value %q", name, arg)
+		}
+		return compare(cmp.Compare(v.Int(), n))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Errorf("invalid validation %s value %q", name, arg)
+		}
+		return compare(cmp.Compare(float64(v.Uint()), n))
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Errorf("invalid validation %s value %q", name, arg)
+		}
+		return compare(cmp.Compare(v.Float(), n))
+	}
+	return fmt.Errorf("validation %s is not supported for %s", name, v.Type())
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"resenje.org/x/config"
+)
+
+type tlsOptions struct {
+	Cert string `yaml:"cert" validate:"required,file-exists"`
+}
+
+type validatedOptions struct {
+	Listen   string        `yaml:"listen" validate:"required,hostport"`
+	Port     int           `yaml:"port" validate:"min=1,max=65535"`
+	Timeout  time.Duration `yaml:"timeout" validate:"min=1s"`
+	Mode     string        `yaml:"mode" validate:"oneof=debug release"`
+	Admins   []string      `yaml:"admins" validate:"min=1,email"`
+	Endpoint string        `yaml:"endpoint" validate:"url"`
+	Name     string        `yaml:"name" validate:"regexp=^[a-z]{1,3}$"`
+	TLS      *tlsOptions   `yaml:"tls"`
+
+	verified bool
+}
+
+func (o *validatedOptions) VerifyAndPrepare() error {
+	o.verified = true
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "cert.pem")
+	writeFile(t, cert, "cert")
+
+	valid := func() *validatedOptions {
+		return &validatedOptions{
+			Listen:   "localhost:80",
+			Port:     80,
+			Timeout:  time.Minute,
+			Mode:     "debug",
+			Admins:   []string{"admin@example.com"},
+			Endpoint: "https://example.com/api",
+			Name:     "abc",
+			TLS:      &tlsOptions{Cert: cert},
+		}
+	}
+
+	if err := config.Validate(valid()); err != nil {
+		t.Fatal(err)
+	}
+
+	o := valid()
+	o.Listen = "localhost"
+	o.Port = 0
+	o.Timeout = time.Millisecond
+	o.Mode = "test"
+	o.Admins = []string{"admin@example.com", "admin"}
+	o.Endpoint = "/api"
+	o.Name = "abcd"
+	o.TLS.Cert = dir
+
+	err := config.Validate(o)
+	var errs config.FieldErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("got error %v, want %T", err, errs)
+	}
+	want := []string{"listen", "port", "timeout", "mode", "admins[1]", "endpoint", "name", "tls.cert"}
+	if len(errs) != len(want) {
+		t.Fatalf("got errors %q, want errors for %q", errs, want)
+	}
+	for i, key := range want {
+		if errs[i].Key != key {
+			t.Errorf("got error %q, want error for %q", errs[i], key)
+		}
+	}
+
+	// file is an alias of file-exists
+	alias := &struct {
+		Cert string `yaml:"cert" validate:"file"`
+	}{Cert: filepath.Join(dir, "missing.pem")}
+	if err := config.Validate(alias); err == nil || !strings.Contains(err.Error(), "must be existing file") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestConfig_VerifyAndPrepare_validate(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "http.yaml"), "listen: localhost\nport: 80\n")
+	t.Setenv("TEST_HTTP_PORT", "70000")
+
+	o := &validatedOptions{Timeout: time.Second}
+	c := config.New("test", dir)
+	c.Register("http", o)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	err := c.VerifyAndPrepare()
+	want := "http: listen: must be host:port: address localhost: missing port in address (" + filepath.Join(dir, "http.yaml") + ":1:1)\n" +
+		"http: port: must be at most 65535 (env TEST_HTTP_PORT)\n" +
+		"http: admins: length must be at least 1\n" +
+		"http: tls.cert: is required"
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %v", err, want)
+	}
+	if o.verified {
+		t.Error("VerifyAndPrepare method called on invalid options")
+	}
+}
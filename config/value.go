@@ -0,0 +1,118 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Value holds a snapshot of values of registered options that is safe to
+// be read concurrently while the configuration is reloaded. Snapshots must
+// not be modified.
+type Value[T Options] struct {
+	p atomic.Pointer[T]
+
+	mu          sync.Mutex
+	listeners   []func(old, new T)
+	subscribers map[chan T]struct{}
+}
+
+// NewValue returns a Value with a copy of current values of options that
+// are registered under the name, which is replaced by Reload when options
+// change. It should be created after Load, as Load does not replace
+// snapshots.
+func NewValue[T Options](c *Config, name string) (*Value[T], error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var current Options
+	for _, o := range c.options {
+		if o.name == name {
+			current = o.o
+		}
+	}
+	if current == nil {
+		return nil, fmt.Errorf("unknown options %q", name)
+	}
+	t, ok := current.(T)
+	if !ok {
+		return nil, fmt.Errorf("options %q are %T, not %T", name, current, t)
+	}
+	v := new(Value[T])
+	// the snapshot is taken and the listener is registered under the same
+	// lock that Reload holds while replacing values, so that no change is
+	// missed
+	v.store(clone(t).(T))
+	if c.listeners == nil {
+		c.listeners = make(map[string][]func(old, new Options))
+	}
+	c.listeners[name] = append(c.listeners[name], func(_, new Options) {
+		v.replace(clone(new).(T))
+	})
+	return v, nil
+}
+
+// Load returns the current snapshot without locking.
+func (v *Value[T]) Load() T {
+	return *v.p.Load()
+}
+
+// OnChange registers a function that is called with the previous and the
+// new snapshot after the snapshot is replaced. Functions are called in
+// order of registration and must not call OnChange or Subscribe.
+func (v *Value[T]) OnChange(fn func(old, new T)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.listeners = append(v.listeners, fn)
+}
+
+// Subscribe returns a channel that receives new snapshots after they
+// replace previous ones and a function that stops the subscription. The
+// channel holds only the latest snapshot, so slow receivers do not block
+// reloads and do not get outdated snapshots.
+func (v *Value[T]) Subscribe() (snapshots <-chan T, cancel func()) {
+	ch := make(chan T, 1)
+
+	v.mu.Lock()
+	if v.subscribers == nil {
+		v.subscribers = make(map[chan T]struct{})
+	}
+	v.subscribers[ch] = struct{}{}
+	v.mu.Unlock()
+
+	return ch, func() {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+
+		delete(v.subscribers, ch)
+	}
+}
+
+func (v *Value[T]) store(t T) {
+	v.p.Store(&t)
+}
+
+func (v *Value[T]) replace(new T) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	old := v.Load()
+	v.store(new)
+	for ch := range v.subscribers {
+		// drop the snapshot that was not received
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- new
+	}
+	for _, fn := range v.listeners {
+		fn(old, new)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"resenje.org/x/config"
+)
+
+func TestValue(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "http.yaml"), "listen: :80\n")
+
+	c := config.New("test", dir)
+	c.Register("http", &testOptions{})
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := config.NewValue[*testOptions](c, "http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := v.Load()
+	if first.Listen != ":80" {
+		t.Fatalf("got listen %q, want %q", first.Listen, ":80")
+	}
+
+	snapshots, cancel := v.Subscribe()
+	defer cancel()
+	var changes []string
+	v.OnChange(func(old, new *testOptions) {
+		changes = append(changes, old.Listen+" -> "+new.Listen)
+	})
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if l := v.Load().Listen; l != ":80" && l != ":8080" {
+					t.Errorf("got listen %q", l)
+					return
+				}
+			}
+		}()
+	}
+
+	writeFile(t, filepath.Join(dir, "http.yaml"), "listen: :8080\n")
+	if err := c.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	close(done)
+	wg.Wait()
+
+	if got := v.Load().Listen; got != ":8080" {
+		t.Errorf("got listen %q, want %q", got, ":8080")
+	}
+	if first.Listen != ":80" {
+		t.Errorf("got previous snapshot listen %q, want %q", first.Listen, ":80")
+	}
+	if s := <-snapshots; s.Listen != ":8080" {
+		t.Errorf("got subscribed listen %q, want %q", s.Listen, ":8080")
+	}
+	if len(changes) != 1 || changes[0] != ":80 -> :8080" {
+		t.Errorf("got changes %v", changes)
+	}
+}
+
+func TestNewValue_errors(t *testing.T) {
+	c := config.New("test")
+	c.Register("http", &testOptions{})
+
+	if _, err := config.NewValue[*testOptions](c, "api"); err == nil || err.Error() != `unknown options "api"` {
+		t.Errorf("got error %v", err)
+	}
+	if _, err := config.NewValue[*smtpOptions](c, "http"); err == nil || err.Error() != `options "http" are *config_test.testOptions, not *config_test.smtpOptions` {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestValue_concurrentReload(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "http.yaml")
+	writeFile(t, filename, "listen: :0\n")
+
+	o := &testOptions{}
+	c := config.New("test", dir)
+	c.Register("http", o)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if err := c.Reload(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	var values []*config.Value[*testOptions]
+	for i := 1; i <= 20; i++ {
+		writeFile(t, filename, fmt.Sprintf("listen: :%d\n", i))
+		v, err := config.NewValue[*testOptions](c, "http")
+		if err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, v)
+	}
+	close(done)
+	wg.Wait()
+
+	if err := c.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range values {
+		if got, want := v.Load().Listen, ":20"; got != want {
+			t.Errorf("value %v: got listen %q, want %q", i, got, want)
+		}
+	}
+	if got, want := o.Listen, ":20"; got != want {
+		t.Errorf("got options listen %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"time"
+)
+
+// OnChange registers a function that is called after Reload replaced values
+// of options with the provided name. The function receives a copy of
+// previous values and the new values.
+func (c *Config) OnChange(name string, fn func(old, new Options)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.listeners == nil {
+		c.listeners = make(map[string][]func(old, new Options))
+	}
+	c.listeners[name] = append(c.listeners[name], fn)
+}
+
+// Reload loads configuration into fresh copies of registered options,
+// starting from their values at registration, and verifies them. Only if
+// all options are successfully loaded and verified, the new values replace
+// the current ones and functions registered with OnChange are called for
+// options that are changed. On error, current values are left intact.
+// Concurrent calls are serialized, so that functions registered with
+// OnChange receive changes in order. The functions must not call Reload.
+//
+// New values are written through pointers to options that were
+// registered, without synchronization with code that reads them, so direct
+// reads of registered options race with Reload. Use Value to read options
+// that are reloaded while the application is running.
+func (c *Config) Reload() error {
+	type change struct {
+		name     string
+		old, new Options
+	}
+
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	c.mu.Lock()
+	fresh := make([]Options, len(c.options))
+	for i, o := range c.options {
+		fresh[i] = clone(o.defaults)
+	}
+	origins, err := c.load(fresh)
+	if err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	if err := c.verify(fresh, origins); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	var changes []change
+	for i, o := range c.options {
+		c.setOrigins(o.name, origins[i])
+		if reflect.DeepEqual(o.o, fresh[i]) {
+			continue
+		}
+		changes = append(changes, change{
+			name: o.name,
+			old:  clone(o.o),
+			new:  fresh[i],
+		})
+		c.options[i].o = replace(o.o, clone(fresh[i]))
+	}
+	listeners := maps.Clone(c.listeners)
+	c.mu.Unlock()
+
+	for _, ch := range changes {
+		for _, fn := range listeners[ch.name] {
+			fn(ch.old, ch.new)
+		}
+	}
+	return nil
+}
+
+// replace sets the value of options o to the value of n if o is a pointer,
+// preserving references to o that are held elsewhere. Otherwise, n is
+// returned to be used instead of o.
+func replace(o, n Options) Options {
+	v := reflect.ValueOf(o)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return n
+	}
+	v.Elem().Set(reflect.ValueOf(n).Elem())
+	return o
+}
+
+// Watch checks configuration files for changes every interval and calls
+// Reload when any of them is created, modified or removed. Reload errors
+// are logged and the previous configuration is kept. Watch blocks until the
+// context is done. As with Reload, registered options must not be read
+// directly while Watch is running, but through Value snapshots.
+func (c *Config) Watch(ctx context.Context, interval time.Duration) error {
+	state := c.filesState()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s := c.filesState()
+			if maps.Equal(s, state) {
+				continue
+			}
+			state = s
+			if err := c.Reload(); err != nil {
+				c.logger().Error("config reload", "error", err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// filesState returns modification times and sizes of all existing
+// configuration files that Load would read and files that they included in
+// the last load.
+func (c *Config) filesState() map[string]fileState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state := make(map[string]fileState)
+	for _, o := range c.options {
+		for i, f := range append(c.files(o.name), c.included[o.name]...) {
+			info, err := f.src.stat(f.name)
+			if err != nil {
+				continue
+			}
+			// file names are not unique across file systems
+			state[fmt.Sprintf("%s:%d:%s", o.name, i, f.name)] = fileState{
+				modTime: info.ModTime(),
+				size:    info.Size(),
+			}
+		}
+	}
+	return state
+}
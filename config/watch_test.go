@@ -0,0 +1,175 @@
+// Copyright (c) 2017, Janoš Guljaš <janos@resenje.org>
+// All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"resenje.org/x/config"
+)
+
+type testOptions struct {
+	Listen  string   `json:"listen" yaml:"listen" envconfig:"LISTEN"`
+	Port    int      `json:"port" yaml:"port" envconfig:"PORT"`
+	Domains []string `json:"domains" yaml:"domains" envconfig:"DOMAINS"`
+}
+
+func (o *testOptions) VerifyAndPrepare() error {
+	if o.Port < 0 {
+		return errors.New("negative port")
+	}
+	return nil
+}
+
+func writeFile(t *testing.T, filename, data string) {
+	t.Helper()
+
+	if err := os.WriteFile(filename, []byte(data), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	// make sure that the modification time is changed on file systems
+	// with coarse time resolution
+	mt := time.Now().Add(time.Duration(len(data)) * time.Second)
+	if err := os.Chtimes(filename, mt, mt); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfig_Reload(t *testing.T) {
+	dir := t.TempDir()
+
+	o := &testOptions{Listen: ":8080"}
+	c := config.New("test", dir)
+	c.Register("http", o)
+
+	writeFile(t, filepath.Join(dir, "http.yaml"), "port: 80\n")
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	var gotOld, gotNew *testOptions
+	c.OnChange("http", func(old, new config.Options) {
+		gotOld, gotNew = old.(*testOptions), new.(*testOptions)
+	})
+
+	writeFile(t, filepath.Join(dir, "http.yaml"), "port: 8000\n")
+	if err := c.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if o.Port != 8000 {
+		t.Errorf("got port %v, want %v", o.Port, 8000)
+	}
+	if o.Listen != ":8080" {
+		t.Errorf("got listen %q, want %q", o.Listen, ":8080")
+	}
+	if gotOld == nil || gotOld.Port != 80 {
+		t.Errorf("got old value %+v, want port %v", gotOld, 80)
+	}
+	if gotNew == nil || gotNew.Port != 8000 {
+		t.Errorf("got new value %+v, want port %v", gotNew, 8000)
+	}
+
+	gotOld, gotNew = nil, nil
+	writeFile(t, filepath.Join(dir, "http.yaml"), "port: -1\n")
+	if err := c.Reload(); err == nil {
+		t.Fatal("expected verification error")
+	}
+	if o.Port != 8000 {
+		t.Errorf("got port %v after failed reload, want %v", o.Port, 8000)
+	}
+	if gotOld != nil || gotNew != nil {
+		t.Error("change listener called after failed reload")
+	}
+}
+
+func TestConfig_Watch(t *testing.T) {
+	dir := t.TempDir()
+
+	o := &testOptions{Port: 80}
+	c := config.New("test", dir)
+	c.Register("http", o)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := make(chan config.Options, 1)
+	c.OnChange("http", func(_, new config.Options) {
+		changed <- new
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- c.Watch(ctx, 10*time.Millisecond)
+	}()
+
+	// let the watcher take the initial state of files
+	time.Sleep(100 * time.Millisecond)
+
+	writeFile(t, filepath.Join(dir, "http.yaml"), "port: 8000\n")
+
+	select {
+	case n := <-changed:
+		if got := n.(*testOptions).Port; got != 8000 {
+			t.Errorf("got port %v, want %v", got, 8000)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("change not detected")
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestConfig_Watch_included(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "http.yaml"), "include: common.yaml\n")
+	writeFile(t, filepath.Join(dir, "common.yaml"), "port: 80\n")
+
+	o := &testOptions{}
+	c := config.New("test", dir)
+	c.Register("http", o)
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := make(chan config.Options, 1)
+	c.OnChange("http", func(_, new config.Options) {
+		changed <- new
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- c.Watch(ctx, 10*time.Millisecond)
+	}()
+
+	// let the watcher take the initial state of files
+	time.Sleep(100 * time.Millisecond)
+
+	writeFile(t, filepath.Join(dir, "common.yaml"), "port: 8000\n")
+
+	select {
+	case n := <-changed:
+		if got := n.(*testOptions).Port; got != 8000 {
+			t.Errorf("got port %v, want %v", got, 8000)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("change of the included file not detected")
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
@@ -3,6 +3,7 @@ module resenje.org/x
 go 1.21
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/kelseyhightower/envconfig v1.4.0
 	gopkg.in/yaml.v3 v3.0.1
 	resenje.org/daemon v0.1.2